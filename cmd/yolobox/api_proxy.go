@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// apiProxyMountPath is where the directory holding the API proxy socket is
+// mounted inside the container.
+const apiProxyMountPath = "/yolobox-api-proxy"
+
+const apiProxySocketName = "api.sock"
+
+// apiProxyPort is the loopback port the in-container forwarder listens on.
+// The agents' base URLs point here; the forwarder relays to the host socket.
+const apiProxyPort = "8790"
+
+// apiProvider describes an API whose key is injected by the keyless proxy.
+type apiProvider struct {
+	name       string
+	prefix     string
+	keyEnv     string
+	baseURLEnv string
+	upstream   string
+	// setKey writes the real credential onto an outgoing request.
+	setKey func(h http.Header, key string)
+}
+
+var apiProviders = []apiProvider{
+	{
+		name:       "Anthropic",
+		prefix:     "/anthropic",
+		keyEnv:     "ANTHROPIC_API_KEY",
+		baseURLEnv: "ANTHROPIC_BASE_URL",
+		upstream:   "https://api.anthropic.com",
+		setKey: func(h http.Header, key string) {
+			h.Set("X-Api-Key", key)
+		},
+	},
+	{
+		name:       "OpenAI",
+		prefix:     "/openai",
+		keyEnv:     "OPENAI_API_KEY",
+		baseURLEnv: "OPENAI_BASE_URL",
+		upstream:   "https://api.openai.com/v1",
+		setKey: func(h http.Header, key string) {
+			h.Set("Authorization", "Bearer "+key)
+		},
+	},
+}
+
+// keylessProxiedEnv reports whether key is an API key the keyless proxy keeps
+// on the host.
+func keylessProxiedEnv(key string) bool {
+	for _, p := range apiProviders {
+		if p.keyEnv == key {
+			return true
+		}
+	}
+	return false
+}
+
+// apiProxyRoute is a provider with its resolved upstream and real key.
+type apiProxyRoute struct {
+	provider apiProvider
+	upstream *url.URL
+	key      string
+}
+
+// apiKeyProxy is a reverse proxy that swaps the container's placeholder key
+// for the real one, so API keys never enter the container environment.
+type apiKeyProxy struct {
+	routes    []apiProxyRoute
+	dummyKey  string
+	transport http.RoundTripper
+
+	dir      string
+	listener net.Listener
+	server   *http.Server
+}
+
+// startAPIKeyProxy starts the keyless proxy for every provider whose key is
+// set on the host, and wires the socket mount, placeholder keys and base URLs
+// into cfg. Returns nil when keyless mode is off.
+func startAPIKeyProxy(cfg *Config) (*apiKeyProxy, error) {
+	if !cfg.Keyless {
+		return nil, nil
+	}
+	var routes []apiProxyRoute
+	for _, p := range apiProviders {
+		key := os.Getenv(p.keyEnv)
+		if key == "" {
+			continue
+		}
+		upstream := p.upstream
+		if override := os.Getenv(p.baseURLEnv); override != "" {
+			upstream = override
+		}
+		u, err := url.Parse(upstream)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s %q", p.baseURLEnv, upstream)
+		}
+		routes = append(routes, apiProxyRoute{provider: p, upstream: u, key: key})
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("--keyless needs ANTHROPIC_API_KEY or OPENAI_API_KEY set on the host")
+	}
+
+	dummyKey, err := newAPIProxyDummyKey()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := hostBridgeDir(cfg, "api-proxy-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API proxy socket dir: %w", err)
+	}
+
+	var proxy *apiKeyProxy
+	if cfg.DryRun == "" {
+		proxy = &apiKeyProxy{routes: routes, dummyKey: dummyKey, transport: http.DefaultTransport}
+		if err := proxy.listen(dir); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	cfg.Mounts = append(cfg.Mounts, dir+":"+apiProxyMountPath)
+	cfg.Env = append(cfg.Env,
+		"YOLOBOX_API_PROXY_SOCKET="+apiProxyMountPath+"/"+apiProxySocketName,
+		"YOLOBOX_API_PROXY_PORT="+apiProxyPort,
+	)
+	var names []string
+	for _, r := range routes {
+		cfg.Env = append(cfg.Env,
+			r.provider.keyEnv+"="+dummyKey,
+			r.provider.baseURLEnv+"=http://127.0.0.1:"+apiProxyPort+r.provider.prefix,
+		)
+		names = append(names, r.provider.name)
+	}
+	info("Keyless mode: %s API keys stay on the host", strings.Join(names, " and "))
+	return proxy, nil
+}
+
+// newAPIProxyDummyKey returns a random per-session placeholder key. The proxy
+// only forwards requests that present it.
+func newAPIProxyDummyKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "yolobox-keyless-" + hex.EncodeToString(buf), nil
+}
+
+func (p *apiKeyProxy) listen(dir string) error {
+	listener, err := listenContainerSocket(dir, apiProxySocketName)
+	if err != nil {
+		return fmt.Errorf("failed to start API proxy: %w", err)
+	}
+	p.dir = dir
+	p.listener = listener
+	p.server = &http.Server{Handler: http.HandlerFunc(p.serveHTTP), ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		_ = p.server.Serve(listener)
+	}()
+	return nil
+}
+
+func (p *apiKeyProxy) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = p.server.Shutdown(ctx)
+	_ = os.RemoveAll(p.dir)
+}
+
+func (p *apiKeyProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var route *apiProxyRoute
+	var rest string
+	for i := range p.routes {
+		prefix := p.routes[i].provider.prefix
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			route = &p.routes[i]
+			rest = strings.TrimPrefix(r.URL.Path, prefix)
+			break
+		}
+	}
+	if route == nil {
+		http.Error(w, "unknown API route", http.StatusNotFound)
+		return
+	}
+	if !p.hasDummyKey(r.Header) {
+		http.Error(w, "missing or invalid yolobox placeholder key", http.StatusUnauthorized)
+		return
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL.Scheme = route.upstream.Scheme
+			pr.Out.URL.Host = route.upstream.Host
+			pr.Out.URL.Path = strings.TrimSuffix(route.upstream.Path, "/") + rest
+			pr.Out.URL.RawPath = ""
+			pr.Out.Host = route.upstream.Host
+			pr.Out.Header.Del("Authorization")
+			pr.Out.Header.Del("X-Api-Key")
+			route.provider.setKey(pr.Out.Header, route.key)
+		},
+		Transport: p.transport,
+		// Flush immediately so streamed (SSE) responses reach the agent
+		// token by token.
+		FlushInterval: -1,
+	}
+	rp.ServeHTTP(w, r)
+}
+
+// hasDummyKey reports whether the request carries this session's placeholder
+// key in either of the headers the agents' SDKs use.
+func (p *apiKeyProxy) hasDummyKey(h http.Header) bool {
+	candidates := []string{h.Get("X-Api-Key"), strings.TrimPrefix(h.Get("Authorization"), "Bearer ")}
+	for _, c := range candidates {
+		if c != "" && subtle.ConstantTimeCompare([]byte(c), []byte(p.dummyKey)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// caCertsMountPath is where the bundle of extra CA certificates is mounted.
+// The entrypoint installs it into the system trust store.
+const caCertsMountPath = "/yolobox-ca-certificates"
+
+const caBundleName = "yolobox-ca.crt"
+
+// systemCABundle is the Debian trust store bundle rebuilt by
+// update-ca-certificates.
+const systemCABundle = "/etc/ssl/certs/ca-certificates.crt"
+
+// caBuildContext names the build context that carries the bundle into custom
+// image builds.
+const caBuildContext = "yolobox-ca"
+
+// proxyEnvVars are forwarded from the host with proxy_passthrough. Both
+// spellings are common and tools disagree about which one they read.
+var proxyEnvVars = []string{
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "ALL_PROXY",
+	"http_proxy", "https_proxy", "no_proxy", "all_proxy",
+}
+
+// loadCACertificates reads the ca_certificates files and returns them as one
+// PEM bundle. Every file must contain at least one certificate.
+func loadCACertificates(paths []string, projectDir string) ([]byte, error) {
+	var bundle bytes.Buffer
+	for _, p := range paths {
+		resolved, err := resolvePath(p, projectDir)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(resolved)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate %q: %w", p, err)
+		}
+		found := 0
+		for rest := data; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, fmt.Errorf("invalid CA certificate in %q: %w", p, err)
+			}
+			if err := pem.Encode(&bundle, block); err != nil {
+				return nil, err
+			}
+			found++
+		}
+		if found == 0 {
+			return nil, fmt.Errorf("no PEM certificates found in %q", p)
+		}
+	}
+	return bundle.Bytes(), nil
+}
+
+func validateCACertificates(cfg Config, projectDir string) error {
+	_, err := loadCACertificates(cfg.CACertificates, projectDir)
+	return err
+}
+
+// prepareCACertificatesDir writes the bundle to a temp dir under
+// ~/.yolobox/tmp that is mounted into the container or passed as a build
+// context. A directory works on every runtime, including Apple container,
+// which cannot mount single files.
+func prepareCACertificatesDir(bundle []byte) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	tmpBase := filepath.Join(home, ".yolobox", "tmp")
+	if err := os.MkdirAll(tmpBase, 0700); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(tmpBase, "ca-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create CA certificate dir: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, caBundleName), bundle, 0644); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to write CA certificates: %w", err)
+	}
+	_ = os.Chmod(dir, 0755)
+	return dir, nil
+}
+
+// caCertificateEnv points tools with their own trust stores at the system
+// bundle, which includes the extra certificates once the entrypoint has run.
+// Node only appends NODE_EXTRA_CA_CERTS to its built-in roots, so it gets the
+// extra certificates alone.
+func caCertificateEnv() []string {
+	return []string{
+		"NODE_EXTRA_CA_CERTS=" + caCertsMountPath + "/" + caBundleName,
+		"REQUESTS_CA_BUNDLE=" + systemCABundle,
+		"SSL_CERT_FILE=" + systemCABundle,
+	}
+}
+
+// proxyPassthroughEnv returns the host's proxy settings as KEY=value pairs.
+func proxyPassthroughEnv() []string {
+	var env []string
+	for _, key := range proxyEnvVars {
+		if val := os.Getenv(key); val != "" {
+			env = append(env, key+"="+val)
+		}
+	}
+	return env
+}
+
+// caBundleDigest identifies the bundle in the generated Dockerfile so custom
+// images are rebuilt when the certificates change.
+func caBundleDigest(bundle []byte) string {
+	sum := sha256.Sum256(bundle)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	composeProjectLabel    = "com.docker.compose.project"
+	composeWorkingDirLabel = "com.docker.compose.project.working_dir"
+	composeNetworkLabel    = "com.docker.compose.network"
+)
+
+// composeProject is a running compose project found for the project dir.
+type composeProject struct {
+	Name    string
+	Dir     string
+	Network string
+}
+
+func validateComposeConfig(cfg Config) error {
+	if !cfg.Compose {
+		return nil
+	}
+	switch {
+	case cfg.Network != "":
+		return fmt.Errorf("cannot use --compose with --network")
+	case cfg.NoNetwork:
+		return fmt.Errorf("cannot use --compose with --no-network")
+	case cfg.Pod != "":
+		return fmt.Errorf("cannot use --compose with --pod")
+	case len(cfg.AllowDomains) > 0:
+		return fmt.Errorf("cannot use --compose with allow_domains")
+	}
+	return nil
+}
+
+// pickComposeProject chooses the running project whose working directory is
+// projectDir or its closest parent, so yolobox can start in a subdirectory.
+// Each line is "project\tworking_dir" as printed by `ps`.
+func pickComposeProject(lines []string, projectDir string) (composeProject, bool) {
+	var best composeProject
+	for _, line := range lines {
+		name, dir, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if !ok || name == "" || dir == "" {
+			continue
+		}
+		dir = canonicalDir(dir)
+		if dir != projectDir && !strings.HasPrefix(projectDir, dir+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > len(best.Dir) {
+			best = composeProject{Name: name, Dir: dir}
+		}
+	}
+	return best, best.Name != ""
+}
+
+func canonicalDir(dir string) string {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	return filepath.Clean(dir)
+}
+
+// findComposeProject looks up the running compose project for projectDir
+// from container labels and resolves its default network. Looking it up on
+// every run keeps working when the directory, and so the project name,
+// changes.
+func findComposeProject(rt Runtime, projectDir string) (composeProject, error) {
+	out, err := rt.Output("ps",
+		"--filter", "label="+composeProjectLabel,
+		"--format", fmt.Sprintf(`{{.Label %q}}{{"\t"}}{{.Label %q}}`, composeProjectLabel, composeWorkingDirLabel),
+	)
+	if err != nil {
+		return composeProject{}, fmt.Errorf("failed to list compose containers: %w", err)
+	}
+	project, ok := pickComposeProject(strings.Split(string(out), "\n"), canonicalDir(projectDir))
+	if !ok {
+		return composeProject{}, fmt.Errorf("no running compose project found for %s (start it with docker compose up)", projectDir)
+	}
+
+	// Compose labels the network it created for the default key, which also
+	// covers a renamed default network (networks.default.name).
+	out, err = rt.Output("network", "ls",
+		"--filter", "label="+composeProjectLabel+"="+project.Name,
+		"--filter", "label="+composeNetworkLabel+"=default",
+		"--format", "{{.Name}}",
+	)
+	if err == nil {
+		if fields := strings.Fields(string(out)); len(fields) > 0 {
+			project.Network = fields[0]
+		}
+	}
+	if project.Network == "" {
+		project.Network = project.Name + "_default"
+	}
+	return project, nil
+}
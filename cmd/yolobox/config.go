@@ -14,25 +14,57 @@ type CustomizeConfig struct {
 	Dockerfile string   `toml:"dockerfile"`
 }
 
+type GitCredentialsConfig struct {
+	Enabled bool     `toml:"enabled"`
+	Allow   []string `toml:"allow"`
+	Confirm bool     `toml:"confirm"`
+}
+
+// KubernetesConfig sets up the claims that stand in for volumes with the
+// Kubernetes runtime.
+type KubernetesConfig struct {
+	StorageClass string `toml:"storage_class"`
+	VolumeSize   string `toml:"volume_size"`
+	// MaxDuration is when the cluster stops the pod, as a Go duration. "0"
+	// means no limit.
+	MaxDuration string `toml:"max_duration"`
+}
+
 type Config struct {
 	Runtime               string   `toml:"runtime"`
+	Isolation             string   `toml:"isolation"`
+	RemoteSync            string   `toml:"remote_sync"`
 	Image                 string   `toml:"image"`
 	Mounts                []string `toml:"mounts"`
 	Env                   []string `toml:"env"`
 	Exclude               []string `toml:"exclude"`
 	CopyAs                []string `toml:"copy_as"`
 	SSHAgent              bool     `toml:"ssh_agent"`
+	SSHAgentKeys          []string `toml:"ssh_agent_keys"`
+	SSHAgentConfirm       bool     `toml:"ssh_agent_confirm"`
 	ReadonlyProject       bool     `toml:"readonly_project"`
 	NoNetwork             bool     `toml:"no_network"`
 	Network               string   `toml:"network"`
+	Compose               bool     `toml:"compose"`
+	AllowDomains          []string `toml:"allow_domains"`
+	NetworkLog            bool     `toml:"network_log"`
+	Ports                 []string `toml:"ports"`
+	HostServices          []string `toml:"host_services"`
+	DNS                   []string `toml:"dns"`
+	DNSSearch             []string `toml:"dns_search"`
+	AddHosts              []string `toml:"add_hosts"`
+	CACertificates        []string `toml:"ca_certificates"`
+	ProxyPassthrough      bool     `toml:"proxy_passthrough"`
 	Pod                   string   `toml:"pod"`
 	NoYolo                bool     `toml:"no_yolo"`
 	Scratch               bool     `toml:"scratch"`
 	ClaudeConfig          bool     `toml:"claude_config"`
 	CodexConfig           bool     `toml:"codex_config"`
+	SyncCredentialsBack   bool     `toml:"sync_credentials_back"`
 	GeminiConfig          bool     `toml:"gemini_config"`
 	GitConfig             bool     `toml:"git_config"`
 	GhToken               bool     `toml:"gh_token"`
+	Keyless               bool     `toml:"keyless"`
 	CopyAgentInstructions bool     `toml:"copy_agent_instructions"`
 	Docker                bool     `toml:"docker"`
 
@@ -46,8 +78,35 @@ type Config struct {
 	RuntimeArgs []string        `toml:"runtime_args"`
 	Customize   CustomizeConfig `toml:"customize"`
 
+	GitCredentials GitCredentialsConfig `toml:"git_credentials"`
+	Kubernetes     KubernetesConfig     `toml:"kubernetes"`
+
+	Services map[string]ServiceConfig `toml:"services"`
+
 	Setup        bool `toml:"-"`
 	RebuildImage bool `toml:"-"`
+
+	// DryRun is "text" or "json" when the run should only be printed.
+	DryRun string `toml:"-"`
+	// Timings reports how long each startup step took.
+	Timings bool `toml:"-"`
+
+	// ContainerName names the container after its session so it can be
+	// found again (set by runCommand).
+	ContainerName string `toml:"-"`
+
+	// OCIRuntime is the engine's --runtime for Isolation (set by
+	// runCommand).
+	OCIRuntime string `toml:"-"`
+
+	// RemoteHost is the engine's host when it runs on another machine, so
+	// host paths are copied into the container instead of bind-mounted (set
+	// by runCommand).
+	RemoteHost string `toml:"-"`
+
+	// SSHAgentSocket overrides the host agent socket mounted into the
+	// container (set when the filtering SSH agent proxy is running).
+	SSHAgentSocket string `toml:"-"`
 }
 
 func defaultConfig() Config {
@@ -121,6 +180,12 @@ func mergeConfig(dst *Config, src Config) {
 	if src.Runtime != "" {
 		dst.Runtime = src.Runtime
 	}
+	if src.Isolation != "" {
+		dst.Isolation = src.Isolation
+	}
+	if src.RemoteSync != "" {
+		dst.RemoteSync = src.RemoteSync
+	}
 	if src.Image != "" {
 		dst.Image = src.Image
 	}
@@ -139,15 +204,51 @@ func mergeConfig(dst *Config, src Config) {
 	if src.SSHAgent {
 		dst.SSHAgent = true
 	}
+	if len(src.SSHAgentKeys) > 0 {
+		dst.SSHAgentKeys = append([]string{}, src.SSHAgentKeys...)
+	}
+	if src.SSHAgentConfirm {
+		dst.SSHAgentConfirm = true
+	}
 	if src.ReadonlyProject {
 		dst.ReadonlyProject = true
 	}
 	if src.NoNetwork {
 		dst.NoNetwork = true
 	}
+	if len(src.AllowDomains) > 0 {
+		dst.AllowDomains = append([]string{}, src.AllowDomains...)
+	}
+	if src.NetworkLog {
+		dst.NetworkLog = true
+	}
+	if len(src.Ports) > 0 {
+		dst.Ports = append([]string{}, src.Ports...)
+	}
+	if len(src.HostServices) > 0 {
+		dst.HostServices = append([]string{}, src.HostServices...)
+	}
+	if len(src.DNS) > 0 {
+		dst.DNS = append([]string{}, src.DNS...)
+	}
+	if len(src.DNSSearch) > 0 {
+		dst.DNSSearch = append([]string{}, src.DNSSearch...)
+	}
+	if len(src.AddHosts) > 0 {
+		dst.AddHosts = append([]string{}, src.AddHosts...)
+	}
+	if len(src.CACertificates) > 0 {
+		dst.CACertificates = append([]string{}, src.CACertificates...)
+	}
+	if src.ProxyPassthrough {
+		dst.ProxyPassthrough = true
+	}
 	if src.Network != "" {
 		dst.Network = src.Network
 	}
+	if src.Compose {
+		dst.Compose = true
+	}
 	if src.Pod != "" {
 		dst.Pod = src.Pod
 	}
@@ -163,6 +264,9 @@ func mergeConfig(dst *Config, src Config) {
 	if src.CodexConfig {
 		dst.CodexConfig = true
 	}
+	if src.SyncCredentialsBack {
+		dst.SyncCredentialsBack = true
+	}
 	if src.GeminiConfig {
 		dst.GeminiConfig = true
 	}
@@ -172,6 +276,9 @@ func mergeConfig(dst *Config, src Config) {
 	if src.GhToken {
 		dst.GhToken = true
 	}
+	if src.Keyless {
+		dst.Keyless = true
+	}
 	if src.CopyAgentInstructions {
 		dst.CopyAgentInstructions = true
 	}
@@ -209,6 +316,32 @@ func mergeConfig(dst *Config, src Config) {
 	if src.Customize.Dockerfile != "" {
 		dst.Customize.Dockerfile = src.Customize.Dockerfile
 	}
+	if src.GitCredentials.Enabled {
+		dst.GitCredentials.Enabled = true
+	}
+	if len(src.GitCredentials.Allow) > 0 {
+		dst.GitCredentials.Allow = append([]string{}, src.GitCredentials.Allow...)
+	}
+	if src.GitCredentials.Confirm {
+		dst.GitCredentials.Confirm = true
+	}
+	if src.Kubernetes.StorageClass != "" {
+		dst.Kubernetes.StorageClass = src.Kubernetes.StorageClass
+	}
+	if src.Kubernetes.VolumeSize != "" {
+		dst.Kubernetes.VolumeSize = src.Kubernetes.VolumeSize
+	}
+	if src.Kubernetes.MaxDuration != "" {
+		dst.Kubernetes.MaxDuration = src.Kubernetes.MaxDuration
+	}
+	// Services merge by name so a project can add to or replace the
+	// global ones.
+	for name, svc := range src.Services {
+		if dst.Services == nil {
+			dst.Services = map[string]ServiceConfig{}
+		}
+		dst.Services[name] = svc
+	}
 }
 
 func printConfig(cfg Config) error {
@@ -217,20 +350,45 @@ func printConfig(cfg Config) error {
 		return err
 	}
 	fmt.Printf("%sruntime:%s %s\n", colorBold, colorReset, resolvedRuntimeName(cfg.Runtime))
+	printStringConfigField("isolation", cfg.Isolation)
+	printStringConfigField("remote_sync", cfg.RemoteSync)
 	fmt.Printf("%simage:%s %s\n", colorBold, colorReset, cfg.Image)
 	fmt.Printf("%sproject:%s %s\n", colorBold, colorReset, projectDir)
 	fmt.Printf("%sssh_agent:%s %t\n", colorBold, colorReset, cfg.SSHAgent)
+	printSliceConfigField("ssh_agent_keys", cfg.SSHAgentKeys)
+	fmt.Printf("%sssh_agent_confirm:%s %t\n", colorBold, colorReset, cfg.SSHAgentConfirm)
 	fmt.Printf("%sreadonly_project:%s %t\n", colorBold, colorReset, cfg.ReadonlyProject)
 	fmt.Printf("%sno_network:%s %t\n", colorBold, colorReset, cfg.NoNetwork)
+	printSliceConfigField("allow_domains", cfg.AllowDomains)
+	fmt.Printf("%snetwork_log:%s %t\n", colorBold, colorReset, cfg.NetworkLog)
+	printSliceConfigField("ports", cfg.Ports)
+	printSliceConfigField("host_services", cfg.HostServices)
+	printSliceConfigField("dns", cfg.DNS)
+	printSliceConfigField("dns_search", cfg.DNSSearch)
+	printSliceConfigField("add_hosts", cfg.AddHosts)
+	printSliceConfigField("ca_certificates", cfg.CACertificates)
+	fmt.Printf("%sproxy_passthrough:%s %t\n", colorBold, colorReset, cfg.ProxyPassthrough)
 	fmt.Printf("%snetwork:%s %s\n", colorBold, colorReset, cfg.Network)
+	fmt.Printf("%scompose:%s %t\n", colorBold, colorReset, cfg.Compose)
+	if cfg.Compose {
+		if rt, err := loadRuntime(cfg.Runtime); err != nil {
+			fmt.Printf("%scompose network:%s (%s)\n", colorBold, colorReset, err)
+		} else if project, err := findComposeProject(rt, projectDir); err != nil {
+			fmt.Printf("%scompose network:%s (%s)\n", colorBold, colorReset, err)
+		} else {
+			fmt.Printf("%scompose network:%s %s (project %s)\n", colorBold, colorReset, project.Network, project.Name)
+		}
+	}
 	fmt.Printf("%spod:%s %s\n", colorBold, colorReset, cfg.Pod)
 	fmt.Printf("%sno_yolo:%s %t\n", colorBold, colorReset, cfg.NoYolo)
 	fmt.Printf("%sscratch:%s %t\n", colorBold, colorReset, cfg.Scratch)
 	fmt.Printf("%sclaude_config:%s %t\n", colorBold, colorReset, cfg.ClaudeConfig)
 	fmt.Printf("%scodex_config:%s %t\n", colorBold, colorReset, cfg.CodexConfig)
+	fmt.Printf("%ssync_credentials_back:%s %t\n", colorBold, colorReset, cfg.SyncCredentialsBack)
 	fmt.Printf("%sgemini_config:%s %t\n", colorBold, colorReset, cfg.GeminiConfig)
 	fmt.Printf("%sgit_config:%s %t\n", colorBold, colorReset, cfg.GitConfig)
 	fmt.Printf("%sgh_token:%s %t\n", colorBold, colorReset, cfg.GhToken)
+	fmt.Printf("%skeyless:%s %t\n", colorBold, colorReset, cfg.Keyless)
 	fmt.Printf("%scopy_agent_instructions:%s %t\n", colorBold, colorReset, cfg.CopyAgentInstructions)
 	fmt.Printf("%sdocker:%s %t\n", colorBold, colorReset, cfg.Docker)
 
@@ -244,6 +402,18 @@ func printConfig(cfg Config) error {
 	printSliceConfigField("runtime_args", cfg.RuntimeArgs)
 	printSliceConfigField("customize.packages", cfg.Customize.Packages)
 	printStringConfigField("customize.dockerfile", cfg.Customize.Dockerfile)
+	fmt.Printf("%sgit_credentials.enabled:%s %t\n", colorBold, colorReset, cfg.GitCredentials.Enabled)
+	printSliceConfigField("git_credentials.allow", cfg.GitCredentials.Allow)
+	fmt.Printf("%sgit_credentials.confirm:%s %t\n", colorBold, colorReset, cfg.GitCredentials.Confirm)
+	printStringConfigField("kubernetes.storage_class", cfg.Kubernetes.StorageClass)
+	printStringConfigField("kubernetes.volume_size", cfg.Kubernetes.VolumeSize)
+	printStringConfigField("kubernetes.max_duration", cfg.Kubernetes.MaxDuration)
+	if len(cfg.Services) == 0 {
+		fmt.Printf("%sservices:%s (none)\n", colorBold, colorReset)
+	}
+	for _, name := range sortedServiceNames(cfg.Services) {
+		printStringConfigField("services."+name+".image", cfg.Services[name].Image)
+	}
 	printSliceConfigField("exclude", cfg.Exclude)
 	printSliceConfigField("copy_as", cfg.CopyAs)
 
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// credentialSyncMountPath is where the container's entrypoint drops copies of
+// the agents' credential files when the session ends.
+const credentialSyncMountPath = "/yolobox-credential-sync"
+
+// credentialSync tracks a host directory the container writes its credential
+// files into on exit, so refreshed OAuth tokens can be written back to the host.
+type credentialSync struct {
+	dir    string
+	claude bool
+	codex  bool
+}
+
+// prepareCredentialSync creates the sync directory and wires its mount and env
+// var into cfg. Returns nil when sync_credentials_back is off or no agent
+// config is being forwarded.
+func prepareCredentialSync(cfg *Config) (*credentialSync, error) {
+	if !cfg.SyncCredentialsBack || (!cfg.ClaudeConfig && !cfg.CodexConfig) {
+		return nil, nil
+	}
+	dir, err := hostBridgeDir(cfg, "credential-sync-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credential sync dir: %w", err)
+	}
+	cfg.Mounts = append(cfg.Mounts, dir+":"+credentialSyncMountPath)
+	cfg.Env = append(cfg.Env, "YOLOBOX_CREDENTIAL_SYNC_DIR="+credentialSyncMountPath)
+	if cfg.DryRun != "" {
+		return nil, nil
+	}
+	return &credentialSync{dir: dir, claude: cfg.ClaudeConfig, codex: cfg.CodexConfig}, nil
+}
+
+// syncBack writes any credentials the container refreshed back to the host.
+// Failures are reported as warnings; the session has already finished.
+func (s *credentialSync) syncBack() {
+	if s.claude {
+		updated, err := syncClaudeCredentialsBack(filepath.Join(s.dir, "claude-credentials.json"), getClaudeCredentials())
+		if err != nil {
+			warn("Failed to write refreshed Claude credentials back to host: %s", err)
+		} else if updated {
+			success("Refreshed Claude credentials written back to host")
+		}
+	}
+	if s.codex {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		updated, err := syncCodexAuthBack(filepath.Join(s.dir, "codex-auth.json"), codexAuthFile(home))
+		if err != nil {
+			warn("Failed to write refreshed Codex credentials back to host: %s", err)
+		} else if updated {
+			success("Refreshed Codex credentials written back to host")
+		}
+	}
+}
+
+func (s *credentialSync) cleanup() {
+	_ = os.RemoveAll(s.dir)
+}
+
+// syncClaudeCredentialsBack compares the credentials the container left in
+// containerPath to the host's current credentials and writes them back when the
+// container's token expires later. Comparing against the host's current copy
+// (rather than the one staged at startup) avoids clobbering a refresh that
+// happened on the host during the session.
+func syncClaudeCredentialsBack(containerPath string, host hostCredentials) (bool, error) {
+	if host.data == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(containerPath)
+	if err != nil {
+		return false, nil
+	}
+	fresh := strings.TrimSpace(string(data))
+	if !claudeCredentialsNewer(fresh, host.data) {
+		return false, nil
+	}
+	return true, writeClaudeCredentials(host, fresh)
+}
+
+// claudeCredentialsNewer reports whether candidate holds an OAuth token that
+// expires after the one in current.
+func claudeCredentialsNewer(candidate, current string) bool {
+	candidateExpiry, ok := claudeCredentialsExpiry(candidate)
+	if !ok {
+		return false
+	}
+	currentExpiry, ok := claudeCredentialsExpiry(current)
+	if !ok {
+		return false
+	}
+	return candidateExpiry > currentExpiry
+}
+
+func claudeCredentialsExpiry(data string) (int64, bool) {
+	var creds struct {
+		ClaudeAiOauth struct {
+			ExpiresAt int64 `json:"expiresAt"`
+		} `json:"claudeAiOauth"`
+	}
+	if err := json.Unmarshal([]byte(data), &creds); err != nil {
+		return 0, false
+	}
+	if creds.ClaudeAiOauth.ExpiresAt == 0 {
+		return 0, false
+	}
+	return creds.ClaudeAiOauth.ExpiresAt, true
+}
+
+// writeClaudeCredentials stores data in the same place host was read from.
+// Each store is updated in a single operation so a concurrent reader never
+// sees a partially written token.
+func writeClaudeCredentials(host hostCredentials, data string) error {
+	switch host.source {
+	case credentialSourceKeychain:
+		account := os.Getenv("USER")
+		if account == "" {
+			if u, err := user.Current(); err == nil {
+				account = u.Username
+			}
+		}
+		// security -i reads the command from stdin, keeping the token out
+		// of the process list. -X takes the data hex encoded, so it needs
+		// no quoting.
+		cmd := exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -a %q -s %q -X %s\n",
+			account, claudeCredentialsService, hex.EncodeToString([]byte(data))))
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("keychain update failed: %s", strings.TrimSpace(string(output)))
+		}
+		return nil
+	case credentialSourceSecretService:
+		cmd := exec.Command("secret-tool", "store", "--label="+claudeCredentialsService, "service", claudeCredentialsService)
+		cmd.Stdin = strings.NewReader(data)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("secret service update failed: %s", strings.TrimSpace(string(output)))
+		}
+		return nil
+	case credentialSourceFile:
+		return writeFileAtomic(host.path, []byte(data), 0600)
+	default:
+		return fmt.Errorf("unknown credential source %q", host.source)
+	}
+}
+
+// syncCodexAuthBack writes the container's auth.json over hostPath when the
+// container refreshed its tokens more recently than the host.
+func syncCodexAuthBack(containerPath, hostPath string) (bool, error) {
+	fresh, err := os.ReadFile(containerPath)
+	if err != nil {
+		return false, nil
+	}
+	current, err := os.ReadFile(hostPath)
+	if err != nil {
+		return false, nil
+	}
+	if !codexAuthNewer(fresh, current) {
+		return false, nil
+	}
+	return true, writeFileAtomic(hostPath, fresh, 0600)
+}
+
+// codexAuthNewer reports whether candidate was refreshed after current,
+// based on Codex's last_refresh timestamp.
+func codexAuthNewer(candidate, current []byte) bool {
+	candidateRefresh, ok := codexAuthLastRefresh(candidate)
+	if !ok {
+		return false
+	}
+	currentRefresh, ok := codexAuthLastRefresh(current)
+	if !ok {
+		return false
+	}
+	return candidateRefresh.After(currentRefresh)
+}
+
+func codexAuthLastRefresh(data []byte) (time.Time, bool) {
+	var auth struct {
+		LastRefresh string `json:"last_refresh"`
+	}
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, auth.LastRefresh)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// codexAuthFile returns the path of Codex's auth file, honoring CODEX_HOME.
+func codexAuthFile(home string) string {
+	if dir := os.Getenv("CODEX_HOME"); dir != "" {
+		return filepath.Join(dir, "auth.json")
+	}
+	return filepath.Join(home, ".codex", "auth.json")
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into
+// place, so readers see either the old or the new contents.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if err := f.Chmod(perm); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// claudeCredentialsService is the item name Claude Code uses for its OAuth
+// credentials in both the macOS Keychain and the Linux Secret Service.
+const claudeCredentialsService = "Claude Code-credentials"
+
+// Credential sources, recorded so refreshed credentials can be written back
+// to the same place they were read from.
+const (
+	credentialSourceKeychain      = "keychain"
+	credentialSourceSecretService = "secret-service"
+	credentialSourceFile          = "file"
+)
+
+// hostCredentials holds credentials read from the host along with where they
+// came from. data is empty when nothing was found.
+type hostCredentials struct {
+	data   string
+	source string
+	path   string
+}
+
+// getClaudeCredentials extracts Claude Code OAuth credentials from the host's
+// credential store. Returns empty data if the platform is unsupported or the
+// user is not logged in.
+func getClaudeCredentials() hostCredentials {
+	switch runtime.GOOS {
+	case "darwin":
+		return getMacOSClaudeCredentials()
+	case "linux":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return hostCredentials{}
+		}
+		return getLinuxClaudeCredentials(home)
+	default:
+		return hostCredentials{}
+	}
+}
+
+// getMacOSClaudeCredentials reads the credentials from the macOS Keychain.
+func getMacOSClaudeCredentials() hostCredentials {
+	cmd := exec.Command("security", "find-generic-password", "-s", claudeCredentialsService, "-w")
+	output, err := cmd.Output()
+	if err != nil {
+		return hostCredentials{}
+	}
+	return hostCredentials{data: strings.TrimSpace(string(output)), source: credentialSourceKeychain}
+}
+
+// getLinuxClaudeCredentials tries the Secret Service (GNOME Keyring, KWallet
+// via libsecret) through secret-tool first, then falls back to the plain
+// credentials file Claude Code writes when no keyring is available.
+func getLinuxClaudeCredentials(home string) hostCredentials {
+	if creds := lookupSecretServiceCredentials(); creds != "" {
+		return hostCredentials{data: creds, source: credentialSourceSecretService}
+	}
+	path := claudeCredentialsFile(home)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hostCredentials{}
+	}
+	creds := strings.TrimSpace(string(data))
+	if !json.Valid([]byte(creds)) {
+		return hostCredentials{}
+	}
+	return hostCredentials{data: creds, source: credentialSourceFile, path: path}
+}
+
+// lookupSecretServiceCredentials queries the Secret Service via secret-tool.
+// The timeout keeps a locked keyring waiting on an unlock prompt from blocking
+// container startup indefinitely.
+func lookupSecretServiceCredentials() string {
+	secretTool, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, secretTool, "lookup", "service", claudeCredentialsService).Output()
+	if err != nil {
+		return ""
+	}
+	creds := strings.TrimSpace(string(output))
+	if !json.Valid([]byte(creds)) {
+		return ""
+	}
+	return creds
+}
+
+// claudeCredentialsFile returns the path of Claude Code's file-based credential
+// store, honoring CLAUDE_CONFIG_DIR the same way Claude Code does.
+func claudeCredentialsFile(home string) string {
+	if dir := os.Getenv("CLAUDE_CONFIG_DIR"); dir != "" {
+		return filepath.Join(dir, ".credentials.json")
+	}
+	return filepath.Join(home, ".claude", ".credentials.json")
+}
+
+// stageClaudeCredentials writes creds to a unique 0600 temp file in
+// ~/.yolobox/tmp/ (unique per invocation to avoid conflicts when multiple
+// yolobox instances run concurrently) and returns its path.
+func stageClaudeCredentials(home, creds string) (string, error) {
+	tmpDir := filepath.Join(home, ".yolobox", "tmp")
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(tmpDir, "claude-credentials-*.json")
+	if err != nil {
+		return "", err
+	}
+	if err := f.Chmod(0600); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if _, err := f.Write([]byte(creds)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
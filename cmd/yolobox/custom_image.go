@@ -5,7 +5,6 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -64,7 +63,10 @@ func loadCustomizeFragment(path string) (string, error) {
 	return strings.TrimSpace(string(data)), nil
 }
 
-func generateCustomDockerfile(baseImage string, packages []string, fragment string) (string, error) {
+// generateCustomDockerfile renders the custom image Dockerfile. caDigest is
+// set when ca_certificates are configured; the bundle is then installed
+// before any package downloads so builds work behind TLS-inspecting proxies.
+func generateCustomDockerfile(baseImage string, packages []string, fragment string, caDigest string) (string, error) {
 	normalized := normalizePackages(packages)
 	for _, pkg := range normalized {
 		if !isValidPackageName(pkg) {
@@ -78,6 +80,14 @@ func generateCustomDockerfile(baseImage string, packages []string, fragment stri
 	builder.WriteString(baseImage)
 	builder.WriteString("\n")
 
+	if caDigest != "" {
+		builder.WriteString("# ca_certificates " + caDigest + "\n")
+		builder.WriteString("USER root\n")
+		builder.WriteString("COPY --from=" + caBuildContext + " " + caBundleName + " /usr/local/share/ca-certificates/" + caBundleName + "\n")
+		builder.WriteString("RUN update-ca-certificates\n")
+		builder.WriteString("USER yolo\n")
+	}
+
 	if len(normalized) > 0 {
 		builder.WriteString("USER root\n")
 		builder.WriteString("RUN --mount=type=cache,target=/var/cache/apt,sharing=locked \\\n")
@@ -108,47 +118,29 @@ func customImageTag(baseImageID, dockerfile string, packages []string) string {
 	return "yolobox-custom:" + hex.EncodeToString(sum[:])[:12]
 }
 
-func inspectImageID(runtimePath, image string) (string, error) {
-	cmd := exec.Command(runtimePath, "image", "inspect", image, "--format", "{{.Id}}")
-	output, err := cmd.Output()
+func inspectImageID(rt Runtime, image string) (string, error) {
+	id, err := rt.ImageID(image)
 	if err != nil {
-		pullCmd := exec.Command(runtimePath, "pull", image)
-		pullCmd.Stdin = os.Stdin
-		pullCmd.Stdout = os.Stdout
-		pullCmd.Stderr = os.Stderr
-		if pullErr := pullCmd.Run(); pullErr != nil {
+		if pullErr := rt.Run("pull", image); pullErr != nil {
 			return "", fmt.Errorf("failed to inspect or pull base image %q: %w", image, err)
 		}
 
-		cmd = exec.Command(runtimePath, "image", "inspect", image, "--format", "{{.Id}}")
-		output, err = cmd.Output()
+		id, err = rt.ImageID(image)
 		if err != nil {
 			return "", fmt.Errorf("failed to inspect base image %q: %w", image, err)
 		}
 	}
-	return strings.TrimSpace(string(output)), nil
-}
-
-func customImageExists(runtimePath, tag string) bool {
-	return exec.Command(runtimePath, "image", "inspect", tag).Run() == nil
+	return id, nil
 }
 
-func buildCustomImage(runtimePath, tag, dockerfilePath, contextDir string) error {
-	cmd := exec.Command(runtimePath, "build", "-t", tag, "-f", dockerfilePath, contextDir)
-	cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+func customImageExists(rt Runtime, tag string) bool {
+	_, err := rt.ImageID(tag)
+	return err == nil
 }
 
-func prepareCustomImage(cfg *Config, projectDir string) (string, error) {
-	runtimePath, err := resolveRuntime(cfg.Runtime)
-	if err != nil {
-		return "", err
-	}
-	if filepath.Base(runtimePath) == "container" {
-		return "", fmt.Errorf("custom images are not supported with Apple container runtime")
+func prepareCustomImage(cfg *Config, rt Runtime, projectDir string) (string, error) {
+	if !rt.Capabilities().Build {
+		return "", fmt.Errorf("custom images are not supported with %s runtime", rt.DisplayName())
 	}
 
 	customizeFile, err := resolveCustomizeFile(cfg.Customize.Dockerfile, projectDir)
@@ -161,20 +153,32 @@ func prepareCustomImage(cfg *Config, projectDir string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	dockerfile, err := generateCustomDockerfile(cfg.Image, cfg.Customize.Packages, fragment)
+	caBundle, err := loadCACertificates(cfg.CACertificates, projectDir)
+	if err != nil {
+		return "", err
+	}
+	caDigest := ""
+	if len(caBundle) > 0 {
+		caDigest = caBundleDigest(caBundle)
+	}
+	dockerfile, err := generateCustomDockerfile(cfg.Image, cfg.Customize.Packages, fragment, caDigest)
 	if err != nil {
 		return "", err
 	}
-	baseImageID, err := inspectImageID(runtimePath, cfg.Image)
+	baseImageID, err := inspectImageID(rt, cfg.Image)
 	if err != nil {
 		return "", err
 	}
 	tag := customImageTag(baseImageID, dockerfile, cfg.Customize.Packages)
 
-	if !cfg.RebuildImage && customizeFile == "" && customImageExists(runtimePath, tag) {
+	if !cfg.RebuildImage && customizeFile == "" && customImageExists(rt, tag) {
 		info("Using custom image %s", tag)
 		return tag, nil
 	}
+	if cfg.DryRun != "" {
+		info("Dry run: not building custom image %s", tag)
+		return tag, nil
+	}
 
 	buildDir, err := os.MkdirTemp("", "yolobox-custom-image-*")
 	if err != nil {
@@ -194,8 +198,30 @@ func prepareCustomImage(cfg *Config, projectDir string) (string, error) {
 		contextDir = projectDir
 	}
 
+	var buildArgs []string
+	if len(caBundle) > 0 {
+		caDir, err := prepareCACertificatesDir(caBundle)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = os.RemoveAll(caDir)
+		}()
+		buildArgs = append(buildArgs, "--build-context", caBuildContext+"="+caDir)
+	}
+	if cfg.ProxyPassthrough {
+		// Name-only build args take their value from the environment, so
+		// proxy credentials stay out of the process list. Docker does not
+		// record these predefined args in the image history.
+		for _, key := range proxyEnvVars {
+			if os.Getenv(key) != "" {
+				buildArgs = append(buildArgs, "--build-arg", key)
+			}
+		}
+	}
+
 	info("Building custom image %s...", tag)
-	if err := buildCustomImage(runtimePath, tag, dockerfilePath, contextDir); err != nil {
+	if err := rt.Build(tag, dockerfilePath, contextDir, buildArgs); err != nil {
 		return "", fmt.Errorf("failed to build custom image: %w", err)
 	}
 	return tag, nil
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// addHostsEnv carries add_hosts entries to the entrypoint on runtimes without
+// an --add-host flag.
+const addHostsEnv = "YOLOBOX_ADD_HOSTS"
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*\.?$`)
+
+// parseAddHost parses an add_hosts entry "hostname:ip". The IP may be IPv6,
+// so only the first colon separates the two.
+func parseAddHost(entry string) (string, string, error) {
+	host, ip, ok := strings.Cut(strings.TrimSpace(entry), ":")
+	if !ok || !hostnamePattern.MatchString(host) {
+		return "", "", fmt.Errorf("invalid add_hosts entry %q; expected hostname:ip like api.local:10.0.0.5", entry)
+	}
+	if net.ParseIP(ip) == nil {
+		return "", "", fmt.Errorf("invalid add_hosts entry %q: %q is not an IP address", entry, ip)
+	}
+	return host, ip, nil
+}
+
+func validateDNSConfig(cfg Config) error {
+	for _, server := range cfg.DNS {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns server %q: must be an IP address", server)
+		}
+	}
+	for _, domain := range cfg.DNSSearch {
+		if !hostnamePattern.MatchString(domain) {
+			return fmt.Errorf("invalid dns_search domain %q", domain)
+		}
+	}
+	for _, entry := range cfg.AddHosts {
+		if _, _, err := parseAddHost(entry); err != nil {
+			return err
+		}
+	}
+	if cfg.Pod != "" && (len(cfg.DNS) > 0 || len(cfg.DNSSearch) > 0 || len(cfg.AddHosts) > 0) {
+		return fmt.Errorf("cannot use dns, dns_search or add_hosts with --pod (set them on the pod instead)")
+	}
+	return nil
+}
+
+// dnsRunArgs translates dns, dns_search and add_hosts into run flags. Every
+// runtime takes --dns and --dns-search; on runtimes without --add-host
+// (Apple container) the entries are appended to /etc/hosts by the
+// entrypoint.
+func dnsRunArgs(cfg Config, addHost bool) []string {
+	var args []string
+	for _, server := range cfg.DNS {
+		args = append(args, "--dns", server)
+	}
+	for _, domain := range cfg.DNSSearch {
+		args = append(args, "--dns-search", domain)
+	}
+	if len(cfg.AddHosts) == 0 {
+		return args
+	}
+	if !addHost {
+		return append(args, "-e", addHostsEnv+"="+strings.Join(cfg.AddHosts, " "))
+	}
+	for _, entry := range cfg.AddHosts {
+		host, ip, err := parseAddHost(entry)
+		if err != nil {
+			continue
+		}
+		args = append(args, "--add-host", host+":"+ip)
+	}
+	return args
+}
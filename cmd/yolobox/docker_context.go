@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultDockerHost is the endpoint of the default docker context.
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerDir is the docker CLI config directory.
+func dockerDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// dockerContext returns the active docker context: DOCKER_CONTEXT, then
+// currentContext from the CLI config, then "default".
+func dockerContext() string {
+	if ctx := os.Getenv("DOCKER_CONTEXT"); ctx != "" {
+		return ctx
+	}
+	if ctx := dockerConfigContext(); ctx != "" {
+		return ctx
+	}
+	return "default"
+}
+
+// dockerConfigContext returns currentContext from the docker CLI config.
+func dockerConfigContext() string {
+	data, err := os.ReadFile(filepath.Join(dockerDir(), "config.json"))
+	if err != nil {
+		return ""
+	}
+	var cfg struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if json.Unmarshal(data, &cfg) != nil {
+		return ""
+	}
+	return cfg.CurrentContext
+}
+
+// dockerHost returns the endpoint the docker CLI talks to: DOCKER_HOST, else
+// the active context's endpoint. It returns "" when the context cannot be
+// resolved.
+func dockerHost() string {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return host
+	}
+	ctx := dockerContext()
+	if ctx == "default" {
+		return defaultDockerHost
+	}
+	return dockerContextHost(ctx)
+}
+
+// dockerContextHost returns the Docker endpoint of a docker context. It
+// reads the metadata the CLI stores under the SHA-256 of the context name,
+// and asks `docker context inspect` when that is missing.
+func dockerContextHost(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	data, err := os.ReadFile(filepath.Join(dockerDir(), "contexts", "meta", hex.EncodeToString(sum[:]), "meta.json"))
+	if err == nil {
+		var meta struct {
+			Endpoints struct {
+				Docker struct {
+					Host string `json:"Host"`
+				} `json:"docker"`
+			} `json:"Endpoints"`
+		}
+		if json.Unmarshal(data, &meta) == nil {
+			return meta.Endpoints.Docker.Host
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "docker", "context", "inspect", name, "--format", "{{.Endpoints.docker.Host}}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// colimaHome is where Colima keeps its profiles.
+func colimaHome() string {
+	if dir := os.Getenv("COLIMA_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".colima")
+}
+
+func colimaSocket(profile string) string {
+	return filepath.Join(colimaHome(), profile, "docker.sock")
+}
+
+// colimaProfileForHost returns the Colima profile whose docker socket host
+// is, as set up by the colima and colima-<profile> contexts.
+func colimaProfileForHost(host string) (string, bool) {
+	sock := unixSocketPath(host)
+	if sock == "" || filepath.Base(sock) != "docker.sock" {
+		return "", false
+	}
+	profileDir := filepath.Dir(sock)
+	if filepath.Dir(profileDir) != filepath.Clean(colimaHome()) {
+		return "", false
+	}
+	return filepath.Base(profileDir), true
+}
+
+// activeColimaProfile returns the Colima profile docker is pointed at:
+// COLIMA_PROFILE, else the profile whose socket DOCKER_HOST or the active
+// context uses.
+func activeColimaProfile() (string, bool) {
+	if profile := os.Getenv("COLIMA_PROFILE"); profile != "" {
+		return profile, true
+	}
+	return colimaProfileForHost(dockerHost())
+}
+
+// colimaProfile returns the Colima profile to use: the active one, else the
+// only running one per `colima list`, else "default".
+func colimaProfile() string {
+	if profile, ok := activeColimaProfile(); ok {
+		return profile
+	}
+	running := runningColimaProfiles()
+	if len(running) == 1 {
+		return running[0]
+	}
+	return "default"
+}
+
+// runningColimaProfiles lists running profiles from `colima list --json`,
+// which prints one JSON object per line.
+func runningColimaProfiles() []string {
+	if _, err := exec.LookPath("colima"); err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "colima", "list", "--json").Output()
+	if err != nil {
+		return nil
+	}
+	return parseColimaList(out)
+}
+
+func parseColimaList(output []byte) []string {
+	var running []string
+	for _, line := range strings.Split(string(output), "\n") {
+		var profile struct {
+			Name   string `json:"name"`
+			Status string `json:"status"`
+		}
+		if json.Unmarshal([]byte(line), &profile) != nil {
+			continue
+		}
+		if strings.EqualFold(profile.Status, "running") {
+			running = append(running, profile.Name)
+		}
+	}
+	return running
+}
+
+// colimaCommand formats a colima subcommand for profile, which colima takes
+// as a positional argument except for the default profile.
+func colimaCommand(profile, subcommand string) string {
+	if profile == "" || profile == "default" {
+		return "colima " + subcommand
+	}
+	return "colima " + subcommand + " " + profile
+}
+
+// memoryFixHint tells the user how to give rt's engine more memory.
+func memoryFixHint(rt Runtime) string {
+	if rt.Name() == "docker" {
+		if profile, ok := activeColimaProfile(); ok {
+			return colimaCommand(profile, "stop") + " && " + colimaCommand(profile, "start") + " --memory 8"
+		}
+	}
+	return "Give the engine 4GB+ in Docker Desktop settings, or colima stop && colima start --memory 8"
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+const (
+	// minFreeDiskGB is the free space below which image pulls and builds
+	// start to fail.
+	minFreeDiskGB = 10
+	// staleImageAge is the base image age after which doctor suggests an
+	// upgrade.
+	staleImageAge = 30 * 24 * time.Hour
+)
+
+// doctorCheck is one line of `yolobox doctor` output.
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// doctor runs the checks against the resolved config and runtime. The host
+// lookups are fields so tests can replace them.
+type doctor struct {
+	cfg    Config
+	cfgErr error
+	rt     Runtime
+	rtErr  error
+	home   string
+	now    time.Time
+
+	goos         string
+	selinuxPath  string
+	freeDiskGB   func(path string) (float64, error)
+	dockerSocket func() (string, error)
+	sshAgent     func() (string, error)
+
+	checks []doctorCheck
+}
+
+func (d *doctor) add(name, status, detail, fix string) {
+	d.checks = append(d.checks, doctorCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+// doctorCommand implements `yolobox doctor`.
+func doctorCommand(args []string, projectDir string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonOutput := fs.Bool("json", false, "print checks as JSON")
+	runtimeFlag := fs.String("runtime", "", "container runtime")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage()
+			return errHelp
+		}
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected args: %v", fs.Args())
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	d := &doctor{
+		home:         home,
+		now:          time.Now(),
+		goos:         runtime.GOOS,
+		selinuxPath:  "/sys/fs/selinux/enforce",
+		freeDiskGB:   freeDiskGB,
+		dockerSocket: findDockerSocket,
+		sshAgent:     findSSHAgentSocket,
+	}
+	// Validation errors are reported as a check; the rest of the checks
+	// still run against the config as loaded.
+	d.cfg, _, d.cfgErr = parseBaseFlags("doctor", nil, projectDir)
+	if d.cfgErr != nil {
+		if cfg, err := loadConfig(projectDir); err == nil {
+			d.cfg = cfg
+		} else {
+			d.cfg = defaultConfig()
+		}
+	}
+	if *runtimeFlag != "" {
+		d.cfg.Runtime = *runtimeFlag
+	}
+	d.rt, d.rtErr = loadRuntime(d.cfg.Runtime)
+	d.run()
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(d.checks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		printDoctorChecks(d.checks)
+	}
+
+	failed := 0
+	for _, c := range d.checks {
+		if c.Status == doctorFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d doctor check(s) failed", failed)
+	}
+	return nil
+}
+
+func printDoctorChecks(checks []doctorCheck) {
+	for _, c := range checks {
+		symbol := colorGreen + "✓"
+		switch c.Status {
+		case doctorWarn:
+			symbol = colorYellow + "!"
+		case doctorFail:
+			symbol = colorRed + "✗"
+		}
+		fmt.Printf("%s%s %s%-13s%s %s\n", symbol, colorReset, colorBold, c.Name, colorReset, c.Detail)
+		if c.Fix != "" {
+			for _, line := range strings.Split(c.Fix, "\n") {
+				fmt.Printf("                %s\n", line)
+			}
+		}
+	}
+}
+
+// run adds every check in display order. Checks that need the engine are
+// skipped when it cannot be resolved or reached.
+func (d *doctor) run() {
+	d.checkConfig()
+	if !d.checkRuntime() {
+		d.checkHost()
+		return
+	}
+	reachable := d.checkDaemon()
+	if reachable {
+		d.checkMemory()
+	}
+	d.checkHost()
+	d.checkRootless()
+	// A cluster pulls images on its nodes and keeps volumes as claims.
+	if reachable && !d.rt.Capabilities().PodSpec {
+		present := d.checkImage()
+		d.checkVolumes(present)
+	}
+	d.checkTmp(reachable)
+	d.checkIsolation()
+}
+
+func (d *doctor) checkConfig() {
+	if d.cfgErr != nil {
+		d.add("config", doctorFail, d.cfgErr.Error(), "Fix ~/.config/yolobox/config.toml or .yolobox.toml, then run yolobox config")
+		return
+	}
+	d.add("config", doctorPass, "config files parse and validate", "")
+}
+
+func (d *doctor) checkRuntime() bool {
+	if d.rtErr != nil {
+		d.add("runtime", doctorFail, d.rtErr.Error(), "Install Docker, Podman, nerdctl, Apple container, or kubectl, or set runtime in config")
+		return false
+	}
+	version := d.rt.DisplayName()
+	if out, err := d.rt.Output("--version"); err == nil && strings.TrimSpace(string(out)) != "" {
+		version = strings.TrimSpace(string(out))
+	}
+	d.add("runtime", doctorPass, version, "")
+	return true
+}
+
+func (d *doctor) checkDaemon() bool {
+	if err := d.rt.Ping(); err != nil {
+		d.add("daemon", doctorFail, fmt.Sprintf("%s is not reachable: %v", d.rt.DisplayName(), err),
+			"Start the engine: Docker Desktop, colima start, podman machine start, or container system start")
+		return false
+	}
+	detail := d.rt.DisplayName() + " is reachable"
+	if d.rt.Name() == "docker" {
+		detail += " (context " + dockerContext() + ")"
+		if profile, ok := activeColimaProfile(); ok {
+			detail += ", Colima profile " + profile
+		}
+	}
+	d.add("daemon", doctorPass, detail, "")
+	return true
+}
+
+func (d *doctor) checkMemory() {
+	memGB, ok := runtimeMemoryGB(d.rt)
+	switch {
+	case !ok:
+		d.add("memory", doctorPass, d.rt.DisplayName()+" does not report a fixed memory size", "")
+	case memGB < minRuntimeMemoryGB:
+		d.add("memory", doctorWarn, fmt.Sprintf("%.1fGB available; Claude Code may get OOM killed", memGB),
+			memoryFixHint(d.rt))
+	default:
+		d.add("memory", doctorPass, fmt.Sprintf("%.1fGB", memGB), "")
+	}
+}
+
+// checkHost covers the host-side checks that do not need the engine.
+func (d *doctor) checkHost() {
+	if free, err := d.freeDiskGB(d.home); err != nil {
+		d.add("disk", doctorWarn, fmt.Sprintf("could not check free space: %v", err), "")
+	} else if free < minFreeDiskGB {
+		d.add("disk", doctorWarn, fmt.Sprintf("%.1fGB free in %s", free, d.home), "Free up space; image pulls and custom image builds need several GB")
+	} else {
+		d.add("disk", doctorPass, fmt.Sprintf("%.0fGB free in %s", free, d.home), "")
+	}
+
+	if sock, err := d.dockerSocket(); err != nil {
+		d.add("docker socket", doctorWarn, err.Error(), "Only needed for --docker; start Docker or set DOCKER_HOST=unix://<path>")
+	} else {
+		d.add("docker socket", doctorPass, sock, "")
+	}
+
+	if sock, err := d.sshAgent(); err != nil {
+		fix := "Only needed for --ssh-agent; start an agent with eval $(ssh-agent)"
+		if d.goos == "darwin" {
+			fix = "Only needed for --ssh-agent"
+		}
+		d.add("ssh agent", doctorWarn, err.Error(), fix)
+	} else {
+		d.add("ssh agent", doctorPass, sock, "")
+	}
+}
+
+func (d *doctor) checkRootless() {
+	if d.rt != nil && d.rt.Capabilities().Pods {
+		if d.rt.Capabilities().Rootless {
+			d.add("rootless", doctorPass, "rootless Podman; bind mounts use --userns=keep-id", "")
+		} else {
+			d.add("rootless", doctorPass, "rootful Podman", "")
+		}
+	}
+	if d.goos != "linux" {
+		return
+	}
+	data, err := os.ReadFile(d.selinuxPath)
+	switch {
+	case err != nil:
+		d.add("selinux", doctorPass, "not enabled", "")
+	case strings.TrimSpace(string(data)) == "1":
+		d.add("selinux", doctorWarn, "enforcing; the project bind mount is not relabeled and may be denied",
+			`If the project is unreadable in the container, set runtime_args = ["--security-opt", "label=disable"]`)
+	default:
+		d.add("selinux", doctorPass, "permissive", "")
+	}
+}
+
+// checkImage reports whether the base image is present and how old it is.
+func (d *doctor) checkImage() bool {
+	image := d.cfg.Image
+	out, err := d.rt.Output("image", "inspect", image, "--format", "{{.Created}}")
+	if err != nil {
+		// Engines without Go templates can still confirm the image exists.
+		if _, err := d.rt.Output("image", "inspect", image); err != nil {
+			d.add("image", doctorWarn, image+" is not pulled yet; the first run will pull it", "yolobox upgrade")
+			return false
+		}
+		d.add("image", doctorPass, image, "")
+		return true
+	}
+	created, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(out)))
+	if err != nil {
+		d.add("image", doctorPass, image, "")
+		return true
+	}
+	age := d.now.Sub(created)
+	days := int(age.Hours() / 24)
+	if age > staleImageAge {
+		d.add("image", doctorWarn, fmt.Sprintf("%s is %d days old", image, days), "yolobox upgrade")
+		return true
+	}
+	d.add("image", doctorPass, fmt.Sprintf("%s (%d days old)", image, days), "")
+	return true
+}
+
+// checkVolumes checks that the yolo user (1000) owns the persistent home and
+// cache volumes. A volume created by a different image or runtime mode can
+// be left owned by root, which breaks tool installs and config writes.
+func (d *doctor) checkVolumes(imagePresent bool) {
+	caps := d.rt.Capabilities()
+	for _, v := range []struct{ name, target string }{
+		{"yolobox-home", "/home/yolo"},
+		{"yolobox-cache", "/var/cache"},
+	} {
+		if _, err := d.rt.Output("volume", "inspect", v.name); err != nil {
+			d.add(v.name, doctorPass, "not created yet", "")
+			continue
+		}
+		if !imagePresent {
+			d.add(v.name, doctorPass, "exists (pull the image to check ownership)", "")
+			continue
+		}
+		args := []string{"run", "--rm", "--entrypoint", "stat"}
+		if caps.Rootless {
+			args = append(args, "--userns=keep-id:uid=1000,gid=1000")
+		}
+		args = append(args, "-v", persistentVolumeMount(v.name, v.target, caps.Rootless), d.cfg.Image, "-c", "%u:%g", v.target)
+		out, err := d.rt.CombinedOutput(args...)
+		owner := strings.TrimSpace(string(out))
+		switch {
+		case err != nil:
+			d.add(v.name, doctorWarn, fmt.Sprintf("could not check ownership: %s", owner), "")
+		case owner != "1000:1000":
+			d.add(v.name, doctorWarn, fmt.Sprintf("%s is owned by %s, not the yolo user (1000:1000)", v.target, owner),
+				"yolobox reset --force recreates the volumes (this deletes their data)")
+		default:
+			d.add(v.name, doctorPass, "owned by the yolo user", "")
+		}
+	}
+}
+
+// checkTmp looks for files a crashed session left in ~/.yolobox/tmp. They
+// are only stale when no yolobox container is running.
+func (d *doctor) checkTmp(reachable bool) {
+	dir := filepath.Join(d.home, ".yolobox", "tmp")
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		d.add("tmp files", doctorPass, "no leftover files in "+dir, "")
+		return
+	}
+	if reachable {
+		out, err := d.rt.Output("ps", "-q", "--filter", "name=yolobox-")
+		if err == nil && strings.TrimSpace(string(out)) != "" {
+			d.add("tmp files", doctorPass, fmt.Sprintf("%d entries in %s in use by running sessions", len(entries), dir), "")
+			return
+		}
+	}
+	d.add("tmp files", doctorWarn, fmt.Sprintf("%d leftover entries in %s", len(entries), dir),
+		"Remove them when no yolobox session is running: rm -rf "+dir)
+}
+
+func (d *doctor) checkIsolation() {
+	available := availableIsolationLevels(d.rt)
+	var missing []string
+	for _, level := range isolationLevels {
+		if !contains(available, level) {
+			missing = append(missing, level)
+		}
+	}
+	detail := "available: " + strings.Join(available, ", ")
+	if len(missing) == 0 {
+		d.add("isolation", doctorPass, detail, "")
+		return
+	}
+	var fixes []string
+	for _, level := range missing {
+		fixes = append(fixes, fmt.Sprintf("%s: %s", level, isolationInstallDocs[level]))
+	}
+	d.add("isolation", doctorPass, detail+"; not installed: "+strings.Join(missing, ", "), strings.Join(fixes, "\n"))
+}
+
+func freeDiskGB(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return float64(uint64(st.Bavail)*uint64(st.Bsize)) / (1024 * 1024 * 1024), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const redactedValue = "<redacted>"
+
+// secretEnvPattern matches env var names whose values are printed as
+// <redacted> by --dry-run.
+var secretEnvPattern = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIAL|API_?KEY|PRIVATE_KEY)`)
+
+var shellSafePattern = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// dryRunFlag is --dry-run, which prints the runtime invocation as a shell
+// line, or --dry-run=json, which prints it as structured JSON.
+type dryRunFlag string
+
+func (f *dryRunFlag) String() string {
+	return string(*f)
+}
+
+func (f *dryRunFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f *dryRunFlag) Set(value string) error {
+	switch value {
+	case "true", "text":
+		*f = "text"
+	case "json":
+		*f = "json"
+	case "false":
+		*f = ""
+	default:
+		return fmt.Errorf("invalid --dry-run value %q: use --dry-run or --dry-run=json", value)
+	}
+	return nil
+}
+
+// dryRunSession is a session whose files go to a temp dir that is removed
+// after the dry run, so it leaves nothing under ~/.yolobox/sessions.
+func dryRunSession(projectDir string, command []string) (*session, error) {
+	now := time.Now()
+	id, err := newSessionID(now)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "yolobox-dry-run-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dry run session dir: %w", err)
+	}
+	return &session{ID: id, Project: projectDir, Command: command, Started: now, dir: dir}, nil
+}
+
+func redactEnv(env string) string {
+	name, value, ok := strings.Cut(env, "=")
+	if !ok || value == "" || !secretEnvPattern.MatchString(name) {
+		return env
+	}
+	return name + "=" + redactedValue
+}
+
+// redactArgs returns a copy of args with secret -e values redacted.
+func redactArgs(args []string) []string {
+	redacted := append([]string{}, args...)
+	for i := 1; i < len(redacted); i++ {
+		if redacted[i-1] == "-e" || redacted[i-1] == "--env" {
+			redacted[i] = redactEnv(redacted[i])
+		}
+	}
+	return redacted
+}
+
+func shellQuote(s string) string {
+	if shellSafePattern.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func shellLine(runtime string, args []string) string {
+	quoted := []string{shellQuote(runtime)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+type dryRunMount struct {
+	Source  string `json:"source,omitempty"`
+	Target  string `json:"target"`
+	Options string `json:"options,omitempty"`
+}
+
+type dryRunEnv struct {
+	Name     string `json:"name"`
+	Value    string `json:"value,omitempty"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+type dryRunRuntimeFlag struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// dryRunPlan is the --dry-run=json output.
+type dryRunPlan struct {
+	Runtime string              `json:"runtime"`
+	Image   string              `json:"image"`
+	Command []string            `json:"command"`
+	Mounts  []dryRunMount       `json:"mounts"`
+	Env     []dryRunEnv         `json:"env"`
+	Flags   []dryRunRuntimeFlag `json:"flags"`
+	Args    []string            `json:"args"`
+	// Setup lists the runtime calls made before the main container, such
+	// as creating the services network and starting the sidecars.
+	Setup [][]string `json:"setup,omitempty"`
+}
+
+// newDryRunPlan builds the plan for args with secret env values redacted.
+func newDryRunPlan(runtime string, args, command []string, setup [][]string) dryRunPlan {
+	plan := parseRunArgs(runtime, redactArgs(args), command)
+	for _, call := range setup {
+		plan.Setup = append(plan.Setup, redactArgs(call))
+	}
+	return plan
+}
+
+// parseRunArgs splits run args, as built by buildRunArgs, into mounts, env
+// and the remaining flags. A flag's value is the next argument when that
+// does not start with a dash.
+func parseRunArgs(runtime string, args, command []string) dryRunPlan {
+	imageIndex := len(args) - len(command) - 1
+	plan := dryRunPlan{
+		Runtime: runtime,
+		Image:   args[imageIndex],
+		Command: command,
+		Mounts:  []dryRunMount{},
+		Env:     []dryRunEnv{},
+		Flags:   []dryRunRuntimeFlag{},
+		Args:    args,
+	}
+
+	for i := 1; i < imageIndex; i++ {
+		name := args[i]
+		value := ""
+		if i+1 < imageIndex && !strings.HasPrefix(args[i+1], "-") {
+			value = args[i+1]
+			i++
+		}
+		plan.add(name, value)
+	}
+	return plan
+}
+
+// add records one run flag in the plan.
+func (plan *dryRunPlan) add(name, value string) {
+	switch name {
+	case "-v", "--volume":
+		parts := strings.SplitN(value, ":", 3)
+		mount := dryRunMount{Target: parts[0]}
+		if len(parts) > 1 {
+			mount = dryRunMount{Source: parts[0], Target: parts[1]}
+		}
+		if len(parts) > 2 {
+			mount.Options = parts[2]
+		}
+		plan.Mounts = append(plan.Mounts, mount)
+	case "-e", "--env":
+		envName, envValue, _ := strings.Cut(value, "=")
+		env := dryRunEnv{Name: envName, Value: envValue}
+		if envValue == redactedValue {
+			env = dryRunEnv{Name: envName, Redacted: true}
+		}
+		plan.Env = append(plan.Env, env)
+	default:
+		plan.Flags = append(plan.Flags, dryRunRuntimeFlag{Name: name, Value: value})
+	}
+}
+
+// printDryRun prints what runCommand would run, with secret env values
+// redacted.
+func printDryRun(mode, runtime string, args, command []string, setup [][]string) error {
+	if mode == "json" {
+		data, err := json.MarshalIndent(newDryRunPlan(runtime, args, command, setup), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, call := range setup {
+		fmt.Println(shellLine(runtime, redactArgs(call)))
+	}
+	fmt.Println(shellLine(runtime, redactArgs(args)))
+	return nil
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// egressProxyMountPath is where the directory holding the egress proxy socket
+// is mounted inside the container.
+const egressProxyMountPath = "/yolobox-egress"
+
+const egressProxySocketName = "egress.sock"
+
+// egressProxyPort is the loopback port the in-container forwarder listens on
+// for HTTP(S)_PROXY traffic.
+const egressProxyPort = "8791"
+
+// egressProxied reports whether the container's traffic is routed through
+// the yolobox egress proxy.
+func egressProxied(cfg Config) bool {
+	return len(cfg.AllowDomains) > 0 || cfg.NetworkLog
+}
+
+func validateEgressConfig(cfg Config) error {
+	if !egressProxied(cfg) {
+		return nil
+	}
+	for _, pattern := range cfg.AllowDomains {
+		if _, err := normalizeDomainPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if len(cfg.AllowDomains) == 0 {
+		// network_log alone keeps the container's network, but the proxy
+		// would still give --no-network a way out.
+		if cfg.NoNetwork {
+			return fmt.Errorf("cannot use network_log with --no-network")
+		}
+		return nil
+	}
+	switch {
+	case cfg.NoNetwork:
+		return fmt.Errorf("cannot use allow_domains with --no-network")
+	case cfg.Network != "":
+		return fmt.Errorf("cannot use allow_domains with --network")
+	case cfg.Pod != "":
+		return fmt.Errorf("cannot use allow_domains with --pod")
+	case cfg.Docker:
+		return fmt.Errorf("cannot use allow_domains with --docker")
+	case cfg.ProxyPassthrough:
+		return fmt.Errorf("cannot use allow_domains with proxy_passthrough")
+	}
+	return nil
+}
+
+// normalizeDomainPattern validates an allow_domains entry: an exact host name
+// or IP, or "*." followed by a domain to match any of its subdomains.
+func normalizeDomainPattern(pattern string) (string, error) {
+	normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	rest := strings.TrimPrefix(normalized, "*.")
+	if rest == "" || strings.ContainsAny(rest, "*/: ") {
+		return "", fmt.Errorf("invalid allow_domains entry %q; expected a host name like api.example.com or *.example.com", pattern)
+	}
+	return normalized, nil
+}
+
+// egressAllowed reports whether host matches the allowlist. "*.example.com"
+// matches subdomains of example.com but not example.com itself.
+func egressAllowed(allow []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, raw := range allow {
+		pattern, err := normalizeDomainPattern(raw)
+		if err != nil {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// egressExplicit reports whether allow names host exactly rather than
+// through a wildcard.
+func egressExplicit(allow []string, host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, raw := range allow {
+		if pattern, err := normalizeDomainPattern(raw); err == nil && pattern == host {
+			return true
+		}
+	}
+	return false
+}
+
+// egressLocal reports whether ip is on the host or its networks: loopback,
+// link-local, private or unspecified. The proxy runs on the host, so it only
+// dials these when allow_domains names the host exactly.
+func egressLocal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// newEgressDial returns the proxy's dialer. It refuses local addresses a
+// host name resolves to unless allow names that host exactly.
+func newEgressDial(allow []string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	direct := &net.Dialer{Timeout: 30 * time.Second}
+	public := &net.Dialer{Timeout: 30 * time.Second, Control: func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip != nil && egressLocal(ip) {
+			return fmt.Errorf("%s is a local address; list the host in allow_domains to reach it", host)
+		}
+		return nil
+	}}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && egressExplicit(allow, host) {
+			return direct.DialContext(ctx, network, addr)
+		}
+		return public.DialContext(ctx, network, addr)
+	}
+}
+
+// egressProxy is an HTTP forward proxy that only lets the container reach
+// allowlisted hosts and optionally logs every connection. It runs in the
+// yolobox process and is reached through a mounted Unix socket. With
+// allow_domains the container has no network of its own; with network_log
+// alone it keeps its network and only proxied traffic is logged.
+type egressProxy struct {
+	allow     []string
+	allowAll  bool
+	netlog    *netlogWriter
+	dial      func(ctx context.Context, network, addr string) (net.Conn, error)
+	transport http.RoundTripper
+
+	dir      string
+	listener net.Listener
+	server   *http.Server
+
+	mu     sync.Mutex
+	denied map[string]int
+}
+
+// startEgressProxy starts the egress proxy and wires the socket mount and
+// proxy env vars into cfg. With network_log, connections are recorded in the
+// session directory. Returns nil when neither allow_domains nor network_log
+// is set.
+func startEgressProxy(cfg *Config, sess *session) (*egressProxy, error) {
+	if !egressProxied(*cfg) {
+		return nil, nil
+	}
+	dir, err := hostBridgeDir(cfg, "egress-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create egress proxy socket dir: %w", err)
+	}
+
+	var proxy *egressProxy
+	if cfg.DryRun == "" {
+		dial := newEgressDial(cfg.AllowDomains)
+		proxy = &egressProxy{
+			allow:     cfg.AllowDomains,
+			allowAll:  len(cfg.AllowDomains) == 0,
+			dial:      dial,
+			transport: &http.Transport{DialContext: dial},
+		}
+		if cfg.NetworkLog {
+			netlog, err := openNetlog(sess.path(netlogFile))
+			if err != nil {
+				_ = os.RemoveAll(dir)
+				return nil, fmt.Errorf("failed to open network log: %w", err)
+			}
+			proxy.netlog = netlog
+		}
+		if err := proxy.listen(dir); err != nil {
+			proxy.netlog.close()
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	proxyURL := "http://127.0.0.1:" + egressProxyPort
+	noProxy := "localhost,127.0.0.1,::1," + hostServicesHostname
+	// Sidecars are on the container's own network, which the proxy cannot
+	// see.
+	for _, name := range sortedServiceNames(cfg.Services) {
+		noProxy += "," + name + "," + cfg.ContainerName + "-" + name
+	}
+	cfg.Mounts = append(cfg.Mounts, dir+":"+egressProxyMountPath)
+	cfg.Env = append(cfg.Env,
+		"YOLOBOX_EGRESS_SOCKET="+egressProxyMountPath+"/"+egressProxySocketName,
+		"YOLOBOX_EGRESS_PORT="+egressProxyPort,
+		"HTTP_PROXY="+proxyURL, "HTTPS_PROXY="+proxyURL,
+		"http_proxy="+proxyURL, "https_proxy="+proxyURL,
+		"NO_PROXY="+noProxy, "no_proxy="+noProxy,
+	)
+	if len(cfg.AllowDomains) > 0 {
+		info("Egress limited to: %s", strings.Join(cfg.AllowDomains, ", "))
+	}
+	if cfg.NetworkLog && proxy != nil {
+		info("Logging network activity (yolobox netlog %s)", sess.ID)
+	}
+	return proxy, nil
+}
+
+func (p *egressProxy) listen(dir string) error {
+	listener, err := listenContainerSocket(dir, egressProxySocketName)
+	if err != nil {
+		return fmt.Errorf("failed to start egress proxy: %w", err)
+	}
+	p.dir = dir
+	p.listener = listener
+	p.server = &http.Server{Handler: http.HandlerFunc(p.serveHTTP), ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		_ = p.server.Serve(listener)
+	}()
+	return nil
+}
+
+func (p *egressProxy) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = p.server.Shutdown(ctx)
+	p.netlog.close()
+	_ = os.RemoveAll(p.dir)
+}
+
+// allowed checks the requested host. Local addresses a host name resolves
+// to are refused when dialing.
+func (p *egressProxy) allowed(host string) bool {
+	ip := net.ParseIP(host)
+	if (ip != nil && egressLocal(ip)) || strings.TrimSuffix(strings.ToLower(host), ".") == "localhost" {
+		return egressExplicit(p.allow, host)
+	}
+	return p.allowAll || egressAllowed(p.allow, host)
+}
+
+func (p *egressProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.serveConnect(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "yolobox egress proxy only accepts proxy requests", http.StatusBadRequest)
+		return
+	}
+	host, port := r.URL.Hostname(), r.URL.Port()
+	if port == "" {
+		port = "80"
+	}
+	entry := netlogEntry{Time: time.Now(), Host: host, Port: port, Method: r.Method}
+	if !p.allowed(host) {
+		p.deny(w, r.URL.Host, entry)
+		return
+	}
+
+	var remote string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			remote = info.Conn.RemoteAddr().String()
+		},
+	}
+	body := &countingReader{r: r.Body}
+	r.Body = body
+	counter := &countingResponseWriter{ResponseWriter: w}
+	var proxyErr error
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out = pr.Out.WithContext(httptrace.WithClientTrace(pr.Out.Context(), trace))
+		},
+		Transport:     p.transport,
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			proxyErr = err
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	rp.ServeHTTP(counter, r)
+
+	entry.Decision = "allow"
+	if proxyErr != nil {
+		entry.Decision = "error"
+		entry.Error = proxyErr.Error()
+	}
+	entry.Remote = remote
+	entry.BytesSent = body.n
+	entry.BytesReceived = counter.n
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+	p.netlog.write(entry)
+}
+
+func (p *egressProxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	host, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host, port = r.Host, "443"
+	}
+	target := net.JoinHostPort(host, port)
+	entry := netlogEntry{Time: time.Now(), Host: host, Port: port, Method: r.Method}
+	if !p.allowed(host) {
+		p.deny(w, target, entry)
+		return
+	}
+
+	upstream, err := p.dial(r.Context(), "tcp", target)
+	if err != nil {
+		entry.Decision = "error"
+		entry.Error = err.Error()
+		entry.DurationMs = time.Since(entry.Time).Milliseconds()
+		p.netlog.write(entry)
+		http.Error(w, "failed to reach "+target, http.StatusBadGateway)
+		return
+	}
+	entry.Decision = "allow"
+	entry.Remote = upstream.RemoteAddr().String()
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		_ = client.Close()
+		_ = upstream.Close()
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Bytes the client sent right after CONNECT may already be buffered.
+		entry.BytesSent, _ = io.Copy(upstream, buffered.Reader)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		entry.BytesReceived, _ = io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	_ = client.Close()
+	_ = upstream.Close()
+	entry.DurationMs = time.Since(entry.Time).Milliseconds()
+	p.netlog.write(entry)
+}
+
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+}
+
+func (p *egressProxy) deny(w http.ResponseWriter, target string, entry netlogEntry) {
+	entry.Decision = "deny"
+	p.netlog.write(entry)
+	p.mu.Lock()
+	if p.denied == nil {
+		p.denied = map[string]int{}
+	}
+	p.denied[target]++
+	p.mu.Unlock()
+	reason := " is not in allow_domains"
+	if p.allowAll {
+		reason = " is a local address; list it in allow_domains to reach it"
+	}
+	http.Error(w, "yolobox: "+target+reason, http.StatusForbidden)
+}
+
+// deniedHosts returns the blocked destinations, most frequent first.
+func (p *egressProxy) deniedHosts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hosts := make([]string, 0, len(p.denied))
+	for host := range p.denied {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if p.denied[hosts[i]] != p.denied[hosts[j]] {
+			return p.denied[hosts[i]] > p.denied[hosts[j]]
+		}
+		return hosts[i] < hosts[j]
+	})
+	return hosts
+}
+
+// reportDenied prints the hosts the session tried to reach but was refused,
+// so the allowlist can be extended.
+func (p *egressProxy) reportDenied() {
+	hosts := p.deniedHosts()
+	if len(hosts) == 0 {
+		return
+	}
+	if p.allowAll {
+		warn("Blocked connections to local addresses:")
+	} else {
+		warn("Blocked connections to hosts not in allow_domains:")
+	}
+	for _, host := range hosts {
+		p.mu.Lock()
+		count := p.denied[host]
+		p.mu.Unlock()
+		fmt.Fprintf(os.Stderr, "  %s (%d)\n", host, count)
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
+
+// countingResponseWriter counts the body bytes written through it. It keeps
+// Flush working so streamed responses are not buffered.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (c *countingResponseWriter) Write(b []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingResponseWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
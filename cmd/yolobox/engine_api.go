@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// engineAPITimeout bounds each Engine API request. The queries are all
+	// metadata lookups that answer in milliseconds.
+	engineAPITimeout = 10 * time.Second
+	// engineAPIPingTimeout bounds the ping that decides whether to use the
+	// API at all, so a stuck socket falls back to the CLI quickly.
+	engineAPIPingTimeout = time.Second
+)
+
+// errEngineNotFound is returned for a 404 from the Engine API.
+var errEngineNotFound = errors.New("not found")
+
+// engineAPI is a minimal client for the Docker Engine API, which Podman also
+// serves, over a Unix socket.
+type engineAPI struct {
+	client *http.Client
+}
+
+func newEngineAPI(socket string) *engineAPI {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &engineAPI{client: &http.Client{Transport: transport, Timeout: engineAPITimeout}}
+}
+
+// do sends a request and decodes a JSON response into out, if given. Error
+// responses carry {"message": ...}, which becomes the error text.
+func (a *engineAPI) do(ctx context.Context, method, path string, body, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://engine"+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return resp.StatusCode, fmt.Errorf("%w: %s", errEngineNotFound, apiErr.Message)
+		}
+		return resp.StatusCode, errors.New(apiErr.Message)
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode %s %s: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func (a *engineAPI) ping(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err := a.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	return err
+}
+
+// apiRuntime answers the preflight queries through the Engine API instead of
+// starting the CLI for each one, which costs 100-300ms a call. Everything
+// else, including the interactive run, still goes through the CLI.
+type apiRuntime struct {
+	Runtime
+	api *engineAPI
+}
+
+// withEngineAPI returns rt backed by the Engine API at socket, or rt itself
+// when there is no socket or it does not answer.
+func withEngineAPI(rt Runtime, socket string) Runtime {
+	if socket == "" || os.Getenv("YOLOBOX_NO_ENGINE_API") != "" {
+		return rt
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return rt
+	}
+	api := newEngineAPI(socket)
+	if err := api.ping(engineAPIPingTimeout); err != nil {
+		return rt
+	}
+	return apiRuntime{Runtime: rt, api: api}
+}
+
+func (r apiRuntime) Ping() error {
+	return r.api.ping(engineAPITimeout)
+}
+
+func (r apiRuntime) ImageID(image string) (string, error) {
+	var resp struct {
+		ID string `json:"Id"`
+	}
+	// Image references keep their slashes; the API routes on the full path.
+	if _, err := r.api.do(context.Background(), http.MethodGet, "/images/"+image+"/json", nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (r apiRuntime) MemTotal() (int64, error) {
+	var resp struct {
+		MemTotal int64 `json:"MemTotal"`
+	}
+	if _, err := r.api.do(context.Background(), http.MethodGet, "/info", nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.MemTotal, nil
+}
+
+func (r apiRuntime) CreateNetwork(name string) error {
+	req := struct {
+		Name           string `json:"Name"`
+		CheckDuplicate bool   `json:"CheckDuplicate"`
+	}{Name: name, CheckDuplicate: true}
+	status, err := r.api.do(context.Background(), http.MethodPost, "/networks/create", req, nil)
+	if status == http.StatusConflict || (err != nil && strings.Contains(err.Error(), "already exists")) {
+		return nil
+	}
+	return err
+}
+
+func (r apiRuntime) RemoveVolumes(force bool, names ...string) error {
+	for _, name := range names {
+		path := "/volumes/" + url.PathEscape(name)
+		if force {
+			path += "?force=true"
+		}
+		_, err := r.api.do(context.Background(), http.MethodDelete, path, nil, nil)
+		if err != nil && !(force && errors.Is(err, errEngineNotFound)) {
+			return fmt.Errorf("failed to remove volume %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// unixSocketPath returns the path of a unix:// host, or "" for any other
+// transport.
+func unixSocketPath(host string) string {
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		return path
+	}
+	return ""
+}
+
+// dockerAPISocket returns the socket the docker CLI talks to, following
+// DOCKER_HOST and the active context.
+func dockerAPISocket() string {
+	return unixSocketPath(dockerHost())
+}
+
+// podmanAPISocket returns the socket of the local Podman service. The CLI
+// does not need it, so it only exists when podman.socket is enabled.
+func podmanAPISocket(rootless bool) string {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return unixSocketPath(host)
+	}
+	if !rootless {
+		return "/run/podman/podman.sock"
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "podman", "podman.sock")
+	}
+	return ""
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unitFormats are the accepted values of generate systemd --format: a Podman
+// quadlet, or a plain systemd user service that calls the engine's CLI.
+var unitFormats = []string{"quadlet", "unit"}
+
+var unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+var systemdSafePattern = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]+$`)
+
+// unitHeader opens every generated file.
+const unitHeader = "# Generated by yolobox generate systemd. Re-run it to update; edits are overwritten.\n"
+
+// quadletKeys maps run flags to the quadlet [Container] keys that take
+// them. Other flags go through PodmanArgs.
+var quadletKeys = map[string]string{
+	"--name":       "ContainerName",
+	"-w":           "WorkingDir",
+	"--network":    "Network",
+	"-p":           "PublishPort",
+	"--userns":     "UserNS",
+	"--cap-add":    "AddCapability",
+	"--cap-drop":   "DropCapability",
+	"--add-host":   "AddHost",
+	"--dns":        "DNS",
+	"--dns-search": "DNSSearch",
+	"--device":     "AddDevice",
+	"--label":      "Label",
+	"--shm-size":   "ShmSize",
+}
+
+type generateOptions struct {
+	name   string
+	format string
+	output string
+}
+
+// unitFile is a generated file, named relative to the output directory.
+type unitFile struct {
+	name    string
+	content string
+}
+
+// generateCommand implements `yolobox generate systemd`.
+func generateCommand(args []string, projectDir string) error {
+	if len(args) == 0 || args[0] != "systemd" {
+		return fmt.Errorf("usage: yolobox generate systemd --name <name> [--format quadlet|unit] [--output <dir>] [flags] <command...>")
+	}
+	opts, rest, err := parseGenerateFlags(args[1:])
+	if err != nil {
+		return err
+	}
+	yoloboxArgs, command := splitToolArgs(rest)
+	cfg, extra, err := parseBaseFlags("generate", yoloboxArgs, projectDir)
+	if err != nil {
+		return err
+	}
+	command = append(extra, command...)
+	if len(command) == 0 {
+		return fmt.Errorf("generate systemd requires a command")
+	}
+	if opts.name == "" {
+		return fmt.Errorf("generate systemd requires --name")
+	}
+	if !unitNamePattern.MatchString(opts.name) {
+		return fmt.Errorf("invalid --name %q: use letters, digits, dots, dashes and underscores", opts.name)
+	}
+	if opts.format != "" && !contains(unitFormats, opts.format) {
+		return fmt.Errorf("invalid --format %q: use %s", opts.format, strings.Join(unitFormats, " or "))
+	}
+
+	files, format, err := generateSystemdUnits(cfg, projectDir, command, opts)
+	if err != nil {
+		return err
+	}
+	if opts.output == "-" {
+		for _, f := range files {
+			fmt.Printf("# %s\n%s\n", f.name, f.content)
+		}
+		return nil
+	}
+
+	dir := opts.output
+	if dir == "" {
+		if dir, err = defaultUnitDir(format); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			return err
+		}
+		info("Wrote %s", path)
+	}
+	success("Start it with: systemctl --user daemon-reload && systemctl --user start %s", opts.name)
+	info("Enable it to start at boot with: loginctl enable-linger $USER")
+	if format == "unit" {
+		info("  and: systemctl --user enable %s", opts.name)
+	}
+	info("Follow its logs with: journalctl --user -u %s -f", opts.name)
+	return nil
+}
+
+// parseGenerateFlags pulls --name, --format and --output out of the flags
+// before the command and returns the rest for parseBaseFlags.
+func parseGenerateFlags(args []string) (generateOptions, []string, error) {
+	var opts generateOptions
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			return opts, append(rest, args[i:]...), nil
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		switch name {
+		case "name", "format", "output":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return opts, nil, fmt.Errorf("--%s requires a value", name)
+				}
+				i++
+				value = args[i]
+			}
+			switch name {
+			case "name":
+				opts.name = value
+			case "format":
+				opts.format = value
+			default:
+				opts.output = value
+			}
+			continue
+		}
+		rest = append(rest, arg)
+		if yoloboxValueFlags[name] && !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			i++
+			rest = append(rest, args[i])
+		}
+	}
+	return opts, rest, nil
+}
+
+// validateUnitConfig rejects options served by the yolobox process, which
+// does not run alongside a unit.
+func validateUnitConfig(cfg Config) error {
+	var feature string
+	switch {
+	case cfg.SSHAgent:
+		feature = "--ssh-agent"
+	case cfg.Keyless:
+		feature = "--keyless"
+	case cfg.GitCredentials.Enabled:
+		feature = "--git-credentials"
+	case egressProxied(cfg):
+		feature = "allow_domains and network_log"
+	case len(cfg.HostServices) > 0:
+		feature = "host_services"
+	case len(cfg.Services) > 0:
+		feature = "services"
+	case cfg.SyncCredentialsBack:
+		feature = "--sync-credentials-back"
+	case len(cfg.Exclude) > 0 || len(cfg.CopyAs) > 0:
+		feature = "--exclude and --copy-as"
+	}
+	if feature != "" {
+		return fmt.Errorf("cannot use %s with generate systemd: it needs yolobox running next to the container", feature)
+	}
+	return nil
+}
+
+// generateSystemdUnits resolves cfg the way runCommand does and renders the
+// unit files for it. Staged config files and the env file are kept in the
+// unit's state directory, since the unit outlives this process.
+func generateSystemdUnits(cfg Config, projectDir string, command []string, opts generateOptions) ([]unitFile, string, error) {
+	rt, err := loadRuntime(cfg.Runtime)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := validateRuntimeCapabilities(cfg, rt); err != nil {
+		return nil, "", err
+	}
+	if caps := rt.Capabilities(); caps.PodSpec || !caps.FileMounts || rt.RemoteHost() != "" {
+		return nil, "", fmt.Errorf("generate systemd needs a local Docker, Podman or nerdctl engine, not %s", rt.DisplayName())
+	}
+	format := opts.format
+	if format == "" {
+		format = "unit"
+		if rt.Name() == "podman" {
+			format = "quadlet"
+		}
+	}
+	if format == "quadlet" && rt.Name() != "podman" {
+		return nil, "", fmt.Errorf("quadlets need the podman runtime; use --format unit with %s", rt.DisplayName())
+	}
+	if err := validateUnitConfig(cfg); err != nil {
+		return nil, "", err
+	}
+
+	if err := applyImageLock(&cfg, projectDir); err != nil {
+		return nil, "", err
+	}
+	if strongIsolation(cfg) {
+		if cfg.OCIRuntime, err = isolationRuntime(rt, cfg.Isolation); err != nil {
+			return nil, "", err
+		}
+	}
+	if hasCustomization(cfg) {
+		image, err := prepareCustomImage(&cfg, rt, projectDir)
+		if err != nil {
+			return nil, "", err
+		}
+		cfg.Image = image
+	}
+	if cfg.Compose {
+		project, err := findComposeProject(rt, projectDir)
+		if err != nil {
+			return nil, "", err
+		}
+		cfg.Network = project.Network
+	}
+	if cfg.Docker {
+		network := cfg.Network
+		if network == "" {
+			network = "yolobox-net"
+		}
+		if err := ensureDockerNetwork(rt, network); err != nil {
+			return nil, "", err
+		}
+	}
+	cfg.ContainerName = "yolobox-" + opts.name
+
+	args, cleanupPaths, err := buildRunArgs(cfg, projectDir, command, false)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		for _, p := range cleanupPaths {
+			_ = os.RemoveAll(p)
+		}
+	}()
+
+	stateDir, err := unitStateDir(opts.name)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.RemoveAll(stateDir); err != nil {
+		return nil, "", err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return nil, "", err
+	}
+	if args, err = persistUnitFiles(args, cleanupPaths, stateDir); err != nil {
+		return nil, "", err
+	}
+	args, env, err := splitEnvArgs(args)
+	if err != nil {
+		return nil, "", err
+	}
+	envFile := filepath.Join(stateDir, "env")
+	if err := os.WriteFile(envFile, []byte(strings.Join(env, "\n")+"\n"), 0600); err != nil {
+		return nil, "", err
+	}
+
+	if format == "quadlet" {
+		return renderQuadlet(opts.name, args, command, envFile), format, nil
+	}
+	runtimePath, err := cachedResolveRuntime(cfg.Runtime)
+	if err != nil {
+		return nil, "", err
+	}
+	return renderSystemdUnit(opts.name, runtimePath, args, envFile), format, nil
+}
+
+func defaultUnitDir(format string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	if format == "quadlet" {
+		return filepath.Join(configDir, "containers", "systemd"), nil
+	}
+	return filepath.Join(configDir, "systemd", "user"), nil
+}
+
+// unitStateDir holds the files a unit's container mounts or reads.
+func unitStateDir(name string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "yolobox", "units", name), nil
+}
+
+// persistUnitFiles copies the temp files buildRunArgs staged into dir and
+// points args at the copies.
+func persistUnitFiles(args, paths []string, dir string) ([]string, error) {
+	out := append([]string{}, args...)
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Base(p))
+		if fi.IsDir() {
+			err = copyDirDereferenced(p, dst)
+		} else {
+			var data []byte
+			if data, err = os.ReadFile(p); err == nil {
+				err = os.WriteFile(dst, data, fi.Mode().Perm())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to keep %s for the unit: %w", p, err)
+		}
+		for i, arg := range out {
+			if arg == p || strings.HasPrefix(arg, p+":") || strings.HasPrefix(arg, p+"/") {
+				out[i] = dst + strings.TrimPrefix(arg, p)
+			}
+		}
+	}
+	return out, nil
+}
+
+// splitEnvArgs removes -e flags from args and returns their KEY=value
+// entries for an env file. A bare KEY takes its value from the current
+// environment, as the engine would when it runs.
+func splitEnvArgs(args []string) ([]string, []string, error) {
+	var out, env []string
+	for i := 0; i < len(args); i++ {
+		if (args[i] == "-e" || args[i] == "--env") && i+1 < len(args) {
+			i++
+			entry := args[i]
+			if !strings.Contains(entry, "=") {
+				value, ok := os.LookupEnv(entry)
+				if !ok {
+					continue
+				}
+				entry += "=" + value
+			}
+			if strings.ContainsAny(entry, "\r\n") {
+				name, _, _ := strings.Cut(entry, "=")
+				return nil, nil, fmt.Errorf("env %s contains a newline, which an env file cannot hold", name)
+			}
+			env = append(env, entry)
+			continue
+		}
+		out = append(out, args[i])
+	}
+	return out, env, nil
+}
+
+// unitRunArgs drops the flags a unit cannot use: there is no terminal to
+// attach.
+func unitRunArgs(args []string) []string {
+	var out []string
+	for _, arg := range args {
+		switch arg {
+		case "-it", "-i", "-t":
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out
+}
+
+// renderSystemdUnit renders a user service that runs the engine CLI.
+func renderSystemdUnit(name, runtimePath string, args []string, envFile string) []unitFile {
+	args = unitRunArgs(args)
+	run := []string{runtimePath, args[0], "--label", "yolobox.unit=" + name, "--env-file", envFile}
+	run = append(run, args[1:]...)
+	container := "yolobox-" + name
+
+	var b strings.Builder
+	b.WriteString(unitHeader)
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=yolobox %s\n", systemdEscape(name))
+	b.WriteString("Wants=network-online.target\nAfter=network-online.target\n\n")
+	b.WriteString("[Service]\n")
+	fmt.Fprintf(&b, "ExecStartPre=-%s rm -f %s\n", systemdQuote(runtimePath), container)
+	fmt.Fprintf(&b, "ExecStart=%s\n", systemdCommandLine(run))
+	fmt.Fprintf(&b, "ExecStop=%s stop %s\n", systemdQuote(runtimePath), container)
+	b.WriteString("Restart=on-failure\n")
+	// The first start may pull the image.
+	b.WriteString("TimeoutStartSec=900\n\n")
+	b.WriteString("[Install]\nWantedBy=default.target\n")
+	return []unitFile{{name: name + ".service", content: b.String()}}
+}
+
+// renderQuadlet renders a Podman quadlet .container file, plus a .volume
+// file for each named volume so Podman creates them with their usual names.
+func renderQuadlet(name string, args, command []string, envFile string) []unitFile {
+	plan := parseRunArgs("podman", unitRunArgs(args), command)
+
+	var container, podmanArgs []string
+	var volumes []unitFile
+	for _, flag := range plan.Flags {
+		flagName, value := flag.Name, flag.Value
+		if before, after, ok := strings.Cut(flagName, "="); ok {
+			flagName, value = before, after
+		}
+		if flagName == "--rm" {
+			// Quadlet containers are removed when they stop.
+			continue
+		}
+		if key, ok := quadletKeys[flagName]; ok && value != "" {
+			container = append(container, key+"="+systemdEscape(value))
+			continue
+		}
+		podmanArgs = append(podmanArgs, flagName)
+		if value != "" {
+			podmanArgs = append(podmanArgs, value)
+		}
+	}
+	container = append(container, "Label=yolobox.unit="+systemdEscape(name))
+	container = append(container, "EnvironmentFile="+systemdEscape(envFile))
+	for _, m := range plan.Mounts {
+		spec := m.Target
+		switch {
+		case m.Source == "":
+		case filepath.IsAbs(m.Source):
+			spec = m.Source + ":" + m.Target
+		default:
+			spec = m.Source + ".volume:" + m.Target
+			volumes = append(volumes, unitFile{
+				name:    m.Source + ".volume",
+				content: unitHeader + "[Volume]\nVolumeName=" + systemdEscape(m.Source) + "\n",
+			})
+		}
+		if m.Options != "" {
+			spec += ":" + m.Options
+		}
+		container = append(container, "Volume="+systemdEscape(spec))
+	}
+
+	var b strings.Builder
+	b.WriteString(unitHeader)
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=yolobox %s\n", systemdEscape(name))
+	b.WriteString("Wants=network-online.target\nAfter=network-online.target\n\n")
+	b.WriteString("[Container]\n")
+	fmt.Fprintf(&b, "Image=%s\n", systemdEscape(plan.Image))
+	if len(command) > 0 {
+		fmt.Fprintf(&b, "Exec=%s\n", systemdCommandLine(command))
+	}
+	for _, line := range container {
+		b.WriteString(line + "\n")
+	}
+	if len(podmanArgs) > 0 {
+		fmt.Fprintf(&b, "PodmanArgs=%s\n", systemdCommandLine(podmanArgs))
+	}
+	b.WriteString("\n[Service]\nRestart=on-failure\n")
+	// The first start may pull the image.
+	b.WriteString("TimeoutStartSec=900\n\n")
+	b.WriteString("[Install]\nWantedBy=default.target\n")
+	return append([]unitFile{{name: name + ".container", content: b.String()}}, volumes...)
+}
+
+// systemdEscape escapes the % specifiers systemd expands in unit values.
+func systemdEscape(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// systemdQuote quotes an argument of an Exec line, where systemd also
+// expands $VARIABLES.
+func systemdQuote(s string) string {
+	if systemdSafePattern.MatchString(s) {
+		return s
+	}
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", "$$").Replace(s)
+	return `"` + systemdEscape(s) + `"`
+}
+
+func systemdCommandLine(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gitCredentialMountPath is where the directory holding the credential bridge
+// socket is mounted inside the container.
+const gitCredentialMountPath = "/yolobox-git-credential"
+
+const gitCredentialSocketName = "git-credential.sock"
+
+func validateGitCredentialsConfig(cfg Config) error {
+	if !cfg.GitCredentials.Enabled {
+		return nil
+	}
+	if len(cfg.GitCredentials.Allow) == 0 {
+		return fmt.Errorf("--git-credentials requires at least one allowed host or repo (git_credentials.allow or --git-credential-allow)")
+	}
+	for _, pattern := range cfg.GitCredentials.Allow {
+		if _, err := normalizeGitCredentialPattern(pattern); err != nil {
+			return err
+		}
+	}
+	if cfg.GhToken {
+		return fmt.Errorf("cannot use --gh-token with --git-credentials (the bridge keeps the token out of the container)")
+	}
+	return nil
+}
+
+// normalizeGitCredentialPattern validates an allowlist entry of the form
+// "host" or "host/owner/repo", where path segments may use glob wildcards.
+func normalizeGitCredentialPattern(pattern string) (string, error) {
+	pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+	pattern = strings.TrimPrefix(pattern, "https://")
+	if pattern == "" {
+		return "", fmt.Errorf("git_credentials.allow entries cannot be blank")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", fmt.Errorf("invalid git_credentials.allow entry %q: %w", pattern, err)
+	}
+	return strings.TrimSuffix(pattern, ".git"), nil
+}
+
+// gitCredentialAllowed reports whether a request for host and repoPath matches
+// the allowlist. Host-only entries cover every repo on that host.
+func gitCredentialAllowed(allow []string, host, repoPath string) bool {
+	target := host
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if repoPath != "" {
+		target = host + "/" + repoPath
+	}
+	for _, raw := range allow {
+		pattern, err := normalizeGitCredentialPattern(raw)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(pattern, host); matched {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// gitCredentialRequest is a parsed `git credential` key=value payload.
+type gitCredentialRequest map[string]string
+
+func parseGitCredentialRequest(r io.Reader) (gitCredentialRequest, error) {
+	req := gitCredentialRequest{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed credential line %q", line)
+		}
+		req[key] = value
+	}
+	return req, scanner.Err()
+}
+
+// gitCredentialServer answers `git credential fill` requests from the
+// container over a Unix socket, so tokens are handed out per request for
+// allowlisted repos instead of living in the container environment.
+type gitCredentialServer struct {
+	allow   []string
+	confirm bool
+	log     io.Writer
+	fill    func(host, repoPath string) (string, string, error)
+	approve func(message string) bool
+
+	dir      string
+	listener net.Listener
+	server   *http.Server
+	logMu    sync.Mutex
+}
+
+// startGitCredentialBridge starts the host-side server and wires the socket
+// mount and env var into cfg. Returns nil when the bridge is disabled.
+func startGitCredentialBridge(cfg *Config) (*gitCredentialServer, error) {
+	if !cfg.GitCredentials.Enabled {
+		return nil, nil
+	}
+	dir, err := hostBridgeDir(cfg, "git-credential-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create git credential socket dir: %w", err)
+	}
+	cfg.Mounts = append(cfg.Mounts, dir+":"+gitCredentialMountPath)
+	cfg.Env = append(cfg.Env, "YOLOBOX_GIT_CREDENTIAL_SOCKET="+gitCredentialMountPath+"/"+gitCredentialSocketName)
+	if cfg.DryRun != "" {
+		info("Dry run: not starting the git credential bridge for: %s", strings.Join(cfg.GitCredentials.Allow, ", "))
+		return nil, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	logDir := filepath.Join(home, ".yolobox", "logs")
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	logFile, err := os.OpenFile(filepath.Join(logDir, "git-credentials.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	srv := &gitCredentialServer{
+		allow:   cfg.GitCredentials.Allow,
+		confirm: cfg.GitCredentials.Confirm,
+		log:     logFile,
+		fill:    fillHostGitCredential,
+		approve: confirmOnHost,
+	}
+	if err := srv.listen(dir); err != nil {
+		_ = logFile.Close()
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	info("Git credential bridge active for: %s", strings.Join(cfg.GitCredentials.Allow, ", "))
+	return srv, nil
+}
+
+// hostBridgeDir creates the directory under ~/.yolobox/tmp that a host
+// bridge mounts into the container. Under --dry-run it only names the
+// directory, so the printed mounts show where it would go.
+func hostBridgeDir(cfg *Config, pattern string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	tmpBase := filepath.Join(home, ".yolobox", "tmp")
+	if cfg.DryRun != "" {
+		return filepath.Join(tmpBase, strings.Replace(pattern, "*", "dry-run", 1)), nil
+	}
+	if err := os.MkdirAll(tmpBase, 0700); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(tmpBase, pattern)
+}
+
+// listenContainerSocket listens on a Unix socket in dir, which is mounted
+// into the container. The container user may have a different UID than the
+// host user (e.g. Docker Desktop), so the socket itself must be
+// world-connectable; ~/.yolobox/tmp is 0700, which keeps other host users out.
+func listenContainerSocket(dir, name string) (net.Listener, error) {
+	listener, err := net.Listen("unix", filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Chmod(listener.Addr().String(), 0777)
+	_ = os.Chmod(dir, 0755)
+	return listener, nil
+}
+
+func (s *gitCredentialServer) listen(dir string) error {
+	listener, err := listenContainerSocket(dir, gitCredentialSocketName)
+	if err != nil {
+		return fmt.Errorf("failed to start git credential bridge: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/get", s.handleGet)
+	s.dir = dir
+	s.listener = listener
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return nil
+}
+
+func (s *gitCredentialServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := parseGitCredentialRequest(io.LimitReader(r.Body, 64*1024))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	host := req["host"]
+	repoPath := req["path"]
+	target := strings.TrimSuffix(strings.Trim(host+"/"+repoPath, "/"), ".git")
+
+	if req["protocol"] != "https" {
+		s.logRequest("deny", target, "protocol "+req["protocol"]+" is not https")
+		http.Error(w, "denied", http.StatusForbidden)
+		return
+	}
+	if !gitCredentialAllowed(s.allow, host, repoPath) {
+		s.logRequest("deny", target, "not in allowlist")
+		http.Error(w, "denied", http.StatusForbidden)
+		return
+	}
+	if s.confirm && !s.approve(fmt.Sprintf("Allow the sandbox to use your git credentials for %s?", target)) {
+		s.logRequest("deny", target, "not approved")
+		http.Error(w, "denied", http.StatusForbidden)
+		return
+	}
+
+	username, password, err := s.fill(host, repoPath)
+	if err != nil {
+		s.logRequest("error", target, err.Error())
+		http.Error(w, "no credentials", http.StatusNotFound)
+		return
+	}
+	s.logRequest("allow", target, "")
+
+	fmt.Fprintf(w, "protocol=https\nhost=%s\n", host)
+	if repoPath != "" {
+		fmt.Fprintf(w, "path=%s\n", repoPath)
+	}
+	fmt.Fprintf(w, "username=%s\npassword=%s\n", username, password)
+}
+
+func (s *gitCredentialServer) logRequest(decision, target, reason string) {
+	s.logMu.Lock()
+	defer s.logMu.Unlock()
+	line := fmt.Sprintf("%s %s %s", time.Now().Format(time.RFC3339), decision, target)
+	if reason != "" {
+		line += " (" + reason + ")"
+	}
+	fmt.Fprintln(s.log, line)
+}
+
+func (s *gitCredentialServer) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_ = s.server.Shutdown(ctx)
+	if closer, ok := s.log.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	_ = os.RemoveAll(s.dir)
+}
+
+// fillHostGitCredential asks the host's own git credential helpers for a
+// credential, falling back to the GitHub CLI token for github.com.
+func fillHostGitCredential(host, repoPath string) (string, string, error) {
+	input := fmt.Sprintf("protocol=https\nhost=%s\n", host)
+	if repoPath != "" {
+		input += "path=" + repoPath + "\n"
+	}
+	input += "\n"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	if output, err := cmd.Output(); err == nil {
+		resp, err := parseGitCredentialRequest(strings.NewReader(string(output)))
+		if err == nil && resp["password"] != "" {
+			return resp["username"], resp["password"], nil
+		}
+	}
+
+	if host == "github.com" {
+		if token := getGhToken(); token != "" {
+			return "x-access-token", token, nil
+		}
+	}
+	return "", "", errors.New("no host credential available")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostConfirmTimeout bounds how long a host-side approval dialog waits before
+// it is treated as a denial.
+const hostConfirmTimeout = 60 * time.Second
+
+var hostConfirmMu sync.Mutex
+
+// confirmOnHost asks the user to approve an action from inside the sandbox.
+// The container owns the terminal while a session runs, so this uses a native
+// dialog (osascript on macOS, zenity or kdialog on Linux) instead of stdin.
+// Returns false when no dialog is available, the user declines, or it times out.
+func confirmOnHost(message string) bool {
+	hostConfirmMu.Lock()
+	defer hostConfirmMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), hostConfirmTimeout)
+	defer cancel()
+
+	switch runtime.GOOS {
+	case "darwin":
+		script := `display dialog ` + appleScriptQuote(message) +
+			` with title "yolobox" buttons {"Deny", "Allow"} default button "Deny" giving up after 55`
+		output, err := exec.CommandContext(ctx, "osascript", "-e", script).Output()
+		if err != nil {
+			return false
+		}
+		return strings.Contains(string(output), "button returned:Allow")
+	default:
+		if path, err := exec.LookPath("zenity"); err == nil {
+			return exec.CommandContext(ctx, path, "--question", "--title=yolobox", "--text="+message).Run() == nil
+		}
+		if path, err := exec.LookPath("kdialog"); err == nil {
+			return exec.CommandContext(ctx, path, "--title", "yolobox", "--yesno", message).Run() == nil
+		}
+		return false
+	}
+}
+
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostServicesHostname resolves to the host from inside the container.
+const hostServicesHostname = "host.yolobox.internal"
+
+// hostServicesLoopback is the in-container address host.yolobox.internal maps
+// to when services are relayed. Only the listed ports listen there.
+const hostServicesLoopback = "127.0.0.2"
+
+// hostServicesMountPath is where the directory holding the per-service relay
+// sockets is mounted inside the container.
+const hostServicesMountPath = "/yolobox-host-services"
+
+var hostServiceNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+
+type hostService struct {
+	name string
+	port int
+}
+
+// envName returns the env var that carries the service's address, e.g.
+// YOLOBOX_HOST_OLLAMA.
+func (s hostService) envName() string {
+	return "YOLOBOX_HOST_" + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+func parseHostService(spec string) (hostService, error) {
+	name, portStr, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok || !hostServiceNamePattern.MatchString(name) {
+		return hostService{}, fmt.Errorf("invalid host_services entry %q; expected name:port like ollama:11434", spec)
+	}
+	port, err := parsePortNumber(portStr)
+	if err != nil {
+		return hostService{}, fmt.Errorf("invalid host_services entry %q: %w", spec, err)
+	}
+	return hostService{name: name, port: port}, nil
+}
+
+func parseHostServices(specs []string) ([]hostService, error) {
+	var services []hostService
+	names := map[string]bool{}
+	ports := map[int]bool{}
+	for _, spec := range specs {
+		svc, err := parseHostService(spec)
+		if err != nil {
+			return nil, err
+		}
+		if names[strings.ToLower(svc.name)] {
+			return nil, fmt.Errorf("duplicate host service name %q", svc.name)
+		}
+		if ports[svc.port] {
+			return nil, fmt.Errorf("duplicate host service port %d", svc.port)
+		}
+		names[strings.ToLower(svc.name)] = true
+		ports[svc.port] = true
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+func validateHostServices(cfg Config) error {
+	_, err := parseHostServices(cfg.HostServices)
+	return err
+}
+
+// hostServiceRelay connects per-service Unix sockets, mounted into the
+// container, to the matching ports on the host's loopback interface. Host
+// services usually listen on localhost only, which a bridged container cannot
+// reach, and relaying per port keeps every unlisted host port unreachable.
+type hostServiceRelay struct {
+	dial func(network, addr string) (net.Conn, error)
+
+	dir       string
+	listeners []net.Listener
+	wg        sync.WaitGroup
+}
+
+// startHostServices wires host_services into cfg. Docker and Podman get a
+// relay per service; Apple container cannot mount host sockets, so the
+// entrypoint maps host.yolobox.internal to the default gateway instead.
+func startHostServices(cfg *Config) (*hostServiceRelay, error) {
+	services, err := parseHostServices(cfg.HostServices)
+	if err != nil || len(services) == 0 {
+		return nil, err
+	}
+
+	cfg.Env = append(cfg.Env, "YOLOBOX_HOST_GATEWAY="+hostServicesHostname)
+	for _, svc := range services {
+		cfg.Env = append(cfg.Env, fmt.Sprintf("%s=%s:%d", svc.envName(), hostServicesHostname, svc.port))
+	}
+	if !runtimeOrDocker(cfg.Runtime).Capabilities().FileMounts {
+		cfg.Env = append(cfg.Env, "YOLOBOX_HOST_GATEWAY_FROM_ROUTE=1")
+		return nil, nil
+	}
+
+	dir, err := hostBridgeDir(cfg, "host-services-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create host services socket dir: %w", err)
+	}
+
+	var relay *hostServiceRelay
+	if cfg.DryRun == "" {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		relay = &hostServiceRelay{dial: dialer.Dial}
+		if err := relay.listen(dir, services); err != nil {
+			relay.close()
+			return nil, err
+		}
+	}
+
+	var forwards, names []string
+	for _, svc := range services {
+		forwards = append(forwards, fmt.Sprintf("%d=%s/%s.sock", svc.port, hostServicesMountPath, svc.name))
+		names = append(names, fmt.Sprintf("%s:%d", svc.name, svc.port))
+	}
+	cfg.Mounts = append(cfg.Mounts, dir+":"+hostServicesMountPath)
+	cfg.Env = append(cfg.Env, "YOLOBOX_HOST_SERVICES="+strings.Join(forwards, " "))
+	info("Host services reachable at %s: %s", hostServicesHostname, strings.Join(names, ", "))
+	return relay, nil
+}
+
+func (r *hostServiceRelay) listen(dir string, services []hostService) error {
+	r.dir = dir
+	for _, svc := range services {
+		listener, err := listenContainerSocket(dir, svc.name+".sock")
+		if err != nil {
+			return fmt.Errorf("failed to start relay for host service %s: %w", svc.name, err)
+		}
+		r.listeners = append(r.listeners, listener)
+
+		target := net.JoinHostPort("localhost", strconv.Itoa(svc.port))
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go r.relay(conn, target)
+			}
+		}()
+	}
+	return nil
+}
+
+func (r *hostServiceRelay) relay(conn net.Conn, target string) {
+	upstream, err := r.dial("tcp", target)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		closeWrite(conn)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	_ = conn.Close()
+	_ = upstream.Close()
+}
+
+func (r *hostServiceRelay) close() {
+	for _, listener := range r.listeners {
+		_ = listener.Close()
+	}
+	r.wg.Wait()
+	if r.dir != "" {
+		_ = os.RemoveAll(r.dir)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// isolationLevels are the accepted values of isolation, weakest first.
+var isolationLevels = []string{"default", "gvisor", "kata"}
+
+// isolationRuntimes lists the names an engine registers each level's OCI
+// runtime under, in order of preference: Docker and Podman use the short
+// names, containerd (nerdctl) the shim type, and Kubernetes the
+// RuntimeClass names the gVisor and Kata installers create.
+var isolationRuntimes = map[string][]string{
+	"gvisor": {"runsc", "io.containerd.runsc.v1", "gvisor"},
+	"kata":   {"kata", "kata-runtime", "io.containerd.kata.v2", "kata-qemu", "kata-clh"},
+}
+
+var isolationInstallDocs = map[string]string{
+	"gvisor": "https://gvisor.dev/docs/user_guide/install/",
+	"kata":   "https://github.com/kata-containers/kata-containers/tree/main/docs/install",
+}
+
+// strongIsolation reports whether the container runs under gVisor or Kata
+// rather than the engine's default runtime.
+func strongIsolation(cfg Config) bool {
+	return cfg.Isolation != "" && cfg.Isolation != "default"
+}
+
+func validateIsolationConfig(cfg Config) error {
+	if !strongIsolation(cfg) {
+		return nil
+	}
+	if _, ok := isolationRuntimes[cfg.Isolation]; !ok {
+		return fmt.Errorf("invalid isolation %q: use %s", cfg.Isolation, strings.Join(isolationLevels, ", "))
+	}
+
+	// The gVisor kernel and the Kata VM cannot connect to host Unix sockets,
+	// which the Docker socket, the SSH agent and every host-side bridge use.
+	var socketFeature string
+	switch {
+	case cfg.Docker:
+		socketFeature = "--docker"
+	case cfg.SSHAgent:
+		socketFeature = "--ssh-agent"
+	case cfg.Keyless:
+		socketFeature = "--keyless"
+	case cfg.GitCredentials.Enabled:
+		socketFeature = "--git-credentials"
+	case egressProxied(cfg):
+		socketFeature = "allow_domains and network_log"
+	case len(cfg.HostServices) > 0:
+		socketFeature = "host_services"
+	}
+	if socketFeature != "" {
+		return fmt.Errorf("cannot use %s with isolation = %q: the sandbox cannot reach host Unix sockets", socketFeature, cfg.Isolation)
+	}
+
+	switch {
+	case len(cfg.Devices) > 0:
+		return fmt.Errorf("cannot use --device with isolation = %q: host devices are not passed into the sandbox", cfg.Isolation)
+	case cfg.GPUs != "":
+		return fmt.Errorf("cannot use --gpus with isolation = %q: host devices are not passed into the sandbox", cfg.Isolation)
+	}
+	for _, arg := range cfg.RuntimeArgs {
+		if arg == "--runtime" || strings.HasPrefix(arg, "--runtime=") {
+			return fmt.Errorf("cannot use --runtime-arg %s with isolation = %q, which selects the OCI runtime", arg, cfg.Isolation)
+		}
+	}
+	return nil
+}
+
+// pickIsolationRuntime returns the first of the level's runtime names that
+// the engine has registered.
+func pickIsolationRuntime(level string, registered []string) (string, bool) {
+	for _, name := range isolationRuntimes[level] {
+		for _, r := range registered {
+			if r == name {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// isolationRuntime resolves the OCI runtime to pass as --runtime for level.
+func isolationRuntime(rt Runtime, level string) (string, error) {
+	registered, err := rt.OCIRuntimes()
+	if err != nil {
+		return "", fmt.Errorf("isolation = %q: %w", level, err)
+	}
+	if name, ok := pickIsolationRuntime(level, registered); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("isolation = %q needs the %s OCI runtime registered with %s (see %s)",
+		level, isolationRuntimes[level][0], rt.DisplayName(), isolationInstallDocs[level])
+}
+
+// availableIsolationLevels returns the levels rt can run, weakest first.
+func availableIsolationLevels(rt Runtime) []string {
+	levels := []string{"default"}
+	registered, err := rt.OCIRuntimes()
+	if err != nil {
+		return levels
+	}
+	for _, level := range isolationLevels[1:] {
+		if _, ok := pickIsolationRuntime(level, registered); ok {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// parseDockerRuntimes returns the runtime names from `info --format
+// {{json .Runtimes}}`.
+func parseDockerRuntimes(output []byte) ([]string, error) {
+	var runtimes map[string]json.RawMessage
+	if err := json.Unmarshal(output, &runtimes); err != nil {
+		return nil, fmt.Errorf("failed to parse runtimes: %w", err)
+	}
+	names := make([]string, 0, len(runtimes))
+	for name := range runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// installedOCIRuntimes returns the names whose binary is in PATH, for engines
+// that resolve --runtime themselves instead of listing registered runtimes.
+func installedOCIRuntimes(binaries map[string]string) []string {
+	var names []string
+	for binary, name := range binaries {
+		if _, err := exec.LookPath(binary); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Names inside the pod. The sync init container holds the pod until the
+// host paths are copied into the sync volume, which the main container then
+// mounts by subPath.
+const (
+	kubernetesContainer     = "yolobox"
+	kubernetesSyncContainer = "sync"
+	kubernetesSyncVolume    = "yolobox-sync"
+	kubernetesSyncDir       = "/sync"
+	kubernetesSeedDir       = "/seed"
+	// kubernetesEnvFile is where the main container saves the environment
+	// the entrypoint set up, so exec'd commands start with it.
+	kubernetesEnvFile = "/tmp/yolobox-env"
+	// kubernetesManagedBy labels everything yolobox creates.
+	kubernetesManagedBy = "app.kubernetes.io/managed-by"
+
+	defaultKubernetesVolumeSize = "10Gi"
+	kubernetesStartTimeout      = 5 * time.Minute
+	// defaultKubernetesPodDeadline is when the cluster stops the pod, in
+	// case yolobox dies without deleting it.
+	defaultKubernetesPodDeadline = 24 * time.Hour
+)
+
+// kubernetesRunFlags are the run flags a pod can express, and whether each
+// takes a value. Any other flag is rejected rather than guessed at.
+var kubernetesRunFlags = map[string]bool{
+	"--rm": false, "-it": false, "-i": false, "-t": false,
+	"--name": true, "-w": true, "--runtime": true,
+	"-v": true, "--volume": true, "-e": true, "--env": true,
+	"--cpus": true, "--memory": true, "--shm-size": true,
+	"--cap-add": true, "--cap-drop": true,
+	"--add-host": true, "--dns": true, "--dns-search": true,
+}
+
+// kubernetesPollInterval is how often the pod's status is checked while it
+// starts. Tests shorten it.
+var kubernetesPollInterval = time.Second
+
+var (
+	kubernetesNamePattern     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	kubernetesQuantityPattern = regexp.MustCompile(`^\d+(\.\d+)?([KMGTPE]i|[kMGTPE])?$`)
+)
+
+// kubernetesStartFailures are the waiting reasons that do not clear up by
+// themselves.
+var kubernetesStartFailures = []string{"ImagePullBackOff", "ErrImageNeverPull", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError"}
+
+// kubernetesRuntime runs the sandbox as a pod through kubectl, in the
+// cluster and namespace of the current context. Host paths are copied in
+// and back out, as for a remote engine.
+type kubernetesRuntime struct {
+	cliRuntime
+}
+
+func (kubernetesRuntime) Name() string        { return "kubernetes" }
+func (kubernetesRuntime) DisplayName() string { return "Kubernetes" }
+
+func (kubernetesRuntime) Capabilities() RuntimeCapabilities {
+	return RuntimeCapabilities{
+		FileMounts: true,
+		AddHost:    true,
+		PodSpec:    true,
+	}
+}
+
+func (kubernetesRuntime) Build(string, string, string, []string) error {
+	return fmt.Errorf("custom images are not supported with Kubernetes runtime; push a prebuilt image and set image")
+}
+
+func (kubernetesRuntime) ImageID(string) (string, error) {
+	return "", fmt.Errorf("Kubernetes nodes pull images themselves; there is no local image to inspect")
+}
+
+func (r kubernetesRuntime) Ping() error {
+	return r.ping("get", "--raw", "/readyz")
+}
+
+// OCIRuntimes lists the cluster's RuntimeClasses, which the pod selects
+// with runtimeClassName.
+func (r kubernetesRuntime) OCIRuntimes() ([]string, error) {
+	output, err := r.Output("get", "runtimeclasses", "-o", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list RuntimeClasses: %w", err)
+	}
+	names := strings.Fields(string(output))
+	sort.Strings(names)
+	return names, nil
+}
+
+func (kubernetesRuntime) MemTotal() (int64, error) {
+	return 0, fmt.Errorf("Kubernetes does not report a fixed memory size")
+}
+
+func (kubernetesRuntime) CreateNetwork(string) error {
+	return fmt.Errorf("networks are not supported with Kubernetes runtime")
+}
+
+// RemoteHost names the current context: the cluster never sees host paths.
+func (r kubernetesRuntime) RemoteHost() string {
+	output, err := r.Output("config", "current-context")
+	if ctx := strings.TrimSpace(string(output)); err == nil && ctx != "" {
+		return "kubernetes://" + ctx
+	}
+	return "kubernetes"
+}
+
+// RemoveVolumes deletes the PersistentVolumeClaims that stand in for
+// volumes.
+func (r kubernetesRuntime) RemoveVolumes(force bool, names ...string) error {
+	args := append([]string{"delete", "pvc"}, names...)
+	if force {
+		args = append(args, "--ignore-not-found")
+	}
+	return r.Run(args...)
+}
+
+// CopyTo extracts archive with tar in the pod. target is POD, for the main
+// container, or POD:CONTAINER.
+func (r kubernetesRuntime) CopyTo(target, dir string, archive io.Reader) error {
+	pod, container := kubernetesTarget(target)
+	return r.copyIn(archive, "exec", "-i", pod, "-c", container, "--", "tar", "-x", "--no-same-owner", "-C", dir)
+}
+
+func (r kubernetesRuntime) CopyFrom(target, p string, w io.Writer) error {
+	pod, container := kubernetesTarget(target)
+	return r.copyOut(w, "exec", pod, "-c", container, "--", "tar", "-c", "-C", path.Dir(p), path.Base(p))
+}
+
+func kubernetesTarget(target string) (pod, container string) {
+	if pod, container, ok := strings.Cut(target, ":"); ok {
+		return pod, container
+	}
+	return target, kubernetesContainer
+}
+
+// validateKubernetesConfig checks the [kubernetes] settings.
+func validateKubernetesConfig(cfg Config) error {
+	if size := cfg.Kubernetes.VolumeSize; size != "" && !kubernetesQuantityPattern.MatchString(size) {
+		return fmt.Errorf("invalid kubernetes.volume_size %q: expected a Kubernetes quantity such as 20Gi", size)
+	}
+	if limit := cfg.Kubernetes.MaxDuration; limit != "" {
+		d, err := time.ParseDuration(limit)
+		if err != nil || d < 0 || (d > 0 && d < time.Second) {
+			return fmt.Errorf("invalid kubernetes.max_duration %q: expected a duration such as 8h, or 0 for no limit", limit)
+		}
+	}
+	return nil
+}
+
+// kubernetesPodDeadline returns how long the pod may run, or 0 for no
+// limit.
+func kubernetesPodDeadline(cfg Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Kubernetes.MaxDuration); err == nil {
+		return d
+	}
+	return defaultKubernetesPodDeadline
+}
+
+// validateKubernetesRun rejects options a pod cannot express. The ones
+// that need the host are rejected by validateRemoteRun.
+func validateKubernetesRun(cfg Config) error {
+	switch {
+	case cfg.NoNetwork:
+		return fmt.Errorf("--no-network is not supported with Kubernetes runtime; use a NetworkPolicy")
+	case cfg.Network != "":
+		return fmt.Errorf("--network is not supported with Kubernetes runtime")
+	case len(cfg.Ports) > 0:
+		return fmt.Errorf("ports are not supported with Kubernetes runtime; use kubectl port-forward")
+	case cfg.GPUs != "":
+		return fmt.Errorf("--gpus is not supported with Kubernetes runtime")
+	case len(cfg.Devices) > 0:
+		return fmt.Errorf("--device is not supported with Kubernetes runtime")
+	case len(cfg.RuntimeArgs) > 0:
+		return fmt.Errorf("runtime_args are not supported with Kubernetes runtime")
+	}
+	return nil
+}
+
+// The subset of the Kubernetes API that yolobox creates.
+type kubeMeta struct {
+	Name            string               `json:"name,omitempty"`
+	Labels          map[string]string    `json:"labels,omitempty"`
+	Annotations     map[string]string    `json:"annotations,omitempty"`
+	OwnerReferences []kubeOwnerReference `json:"ownerReferences,omitempty"`
+}
+
+type kubeOwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+type kubeObject struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeMeta          `json:"metadata"`
+	Spec       any               `json:"spec,omitempty"`
+	StringData map[string]string `json:"stringData,omitempty"`
+	Items      []kubeObject      `json:"items,omitempty"`
+}
+
+type kubePodSpec struct {
+	RestartPolicy         string          `json:"restartPolicy"`
+	ActiveDeadlineSeconds int64           `json:"activeDeadlineSeconds,omitempty"`
+	RuntimeClassName      string          `json:"runtimeClassName,omitempty"`
+	SecurityContext       kubePodSecurity `json:"securityContext"`
+	HostAliases           []kubeHostAlias `json:"hostAliases,omitempty"`
+	DNSPolicy             string          `json:"dnsPolicy,omitempty"`
+	DNSConfig             *kubeDNSConfig  `json:"dnsConfig,omitempty"`
+	InitContainers        []kubeContainer `json:"initContainers"`
+	Containers            []kubeContainer `json:"containers"`
+	Volumes               []kubeVolume    `json:"volumes"`
+}
+
+type kubePodSecurity struct {
+	FSGroup int `json:"fsGroup"`
+}
+
+type kubeHostAlias struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+}
+
+type kubeDNSConfig struct {
+	Nameservers []string `json:"nameservers,omitempty"`
+	Searches    []string `json:"searches,omitempty"`
+}
+
+type kubeContainer struct {
+	Name            string                 `json:"name"`
+	Image           string                 `json:"image"`
+	Command         []string               `json:"command,omitempty"`
+	Args            []string               `json:"args,omitempty"`
+	WorkingDir      string                 `json:"workingDir,omitempty"`
+	Env             []kubeEnv              `json:"env,omitempty"`
+	Resources       *kubeResources         `json:"resources,omitempty"`
+	SecurityContext *kubeContainerSecurity `json:"securityContext,omitempty"`
+	VolumeMounts    []kubeVolumeMount      `json:"volumeMounts,omitempty"`
+	ReadinessProbe  *kubeProbe             `json:"readinessProbe,omitempty"`
+}
+
+type kubeEnv struct {
+	Name      string        `json:"name"`
+	Value     string        `json:"value,omitempty"`
+	ValueFrom *kubeEnvValue `json:"valueFrom,omitempty"`
+}
+
+type kubeEnvValue struct {
+	SecretKeyRef kubeKeyRef `json:"secretKeyRef"`
+}
+
+type kubeKeyRef struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+type kubeResources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+type kubeContainerSecurity struct {
+	Capabilities kubeCapabilities `json:"capabilities"`
+}
+
+type kubeCapabilities struct {
+	Add  []string `json:"add,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+type kubeVolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+type kubeProbe struct {
+	Exec          kubeExecAction `json:"exec"`
+	PeriodSeconds int            `json:"periodSeconds"`
+}
+
+type kubeExecAction struct {
+	Command []string `json:"command"`
+}
+
+type kubeVolume struct {
+	Name                  string           `json:"name"`
+	EmptyDir              *kubeEmptyDir    `json:"emptyDir,omitempty"`
+	PersistentVolumeClaim *kubeClaimSource `json:"persistentVolumeClaim,omitempty"`
+}
+
+type kubeEmptyDir struct {
+	Medium    string `json:"medium,omitempty"`
+	SizeLimit string `json:"sizeLimit,omitempty"`
+}
+
+type kubeClaimSource struct {
+	ClaimName string `json:"claimName"`
+}
+
+type kubeClaimSpec struct {
+	AccessModes      []string      `json:"accessModes"`
+	StorageClassName string        `json:"storageClassName,omitempty"`
+	Resources        kubeResources `json:"resources"`
+}
+
+// kubernetesPod is a run translated into the objects kubectl creates.
+type kubernetesPod struct {
+	name   string
+	pod    kubeObject
+	secret *kubeObject
+	// claims are the PersistentVolumeClaims for named volumes, which
+	// outlive the pod.
+	claims []kubeObject
+	// mounts are the host paths copied into the sync volume, mount i
+	// under syncPaths[i].
+	mounts    []*remoteMount
+	syncPaths []string
+	stdin     bool
+	tty       bool
+	command   []string
+}
+
+// newKubernetesPod translates run args, as built by buildRunArgs, into a
+// pod. Host bind mounts become subPaths of the sync volume, named volumes
+// PersistentVolumeClaims of the same name, and anonymous volumes emptyDirs.
+// Secret env values go into a Secret instead of the pod spec.
+func newKubernetesPod(cfg Config, args, command []string) (*kubernetesPod, error) {
+	plan, err := parseKubernetesRunArgs(args, command)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.ContainerName
+	kp := &kubernetesPod{name: name, command: command}
+	if len(kp.command) == 0 {
+		kp.command = []string{"bash"}
+	}
+
+	main := kubeContainer{
+		Name:  kubernetesContainer,
+		Image: plan.Image,
+		// The entrypoint sets up the home directory, then runs this, which
+		// saves its environment for exec and keeps the pod alive.
+		Args: []string{"sh", "-c", "export -p > " + kubernetesEnvFile + ".tmp && mv " + kubernetesEnvFile + ".tmp " + kubernetesEnvFile + " && exec sleep infinity"},
+		ReadinessProbe: &kubeProbe{
+			Exec:          kubeExecAction{Command: []string{"test", "-e", kubernetesEnvFile}},
+			PeriodSeconds: 1,
+		},
+	}
+	spec := kubePodSpec{
+		RestartPolicy:         "Never",
+		ActiveDeadlineSeconds: int64(kubernetesPodDeadline(cfg) / time.Second),
+		// The yolo user's group, so it can write the volumes.
+		SecurityContext: kubePodSecurity{FSGroup: 1000},
+		Volumes:         []kubeVolume{{Name: kubernetesSyncVolume, EmptyDir: &kubeEmptyDir{}}},
+	}
+
+	secretName := name + "-env"
+	secretData := map[string]string{}
+	for _, env := range plan.Env {
+		switch {
+		case env.Name == "YOLOBOX_HOST_UID" || env.Name == "YOLOBOX_HOST_GID":
+			// The project is a copy owned by the yolo user, so the
+			// entrypoint must not remap it to the host owner.
+			continue
+		case env.Value != "" && secretEnvPattern.MatchString(env.Name):
+			secretData[env.Name] = env.Value
+			main.Env = append(main.Env, kubeEnv{Name: env.Name, ValueFrom: &kubeEnvValue{SecretKeyRef: kubeKeyRef{Name: secretName, Key: env.Name}}})
+		default:
+			main.Env = append(main.Env, kubeEnv{Name: env.Name, Value: env.Value})
+		}
+	}
+	if len(secretData) > 0 {
+		kp.secret = &kubeObject{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata:   kubeMeta{Name: secretName, Labels: map[string]string{kubernetesManagedBy: "yolobox"}},
+			StringData: secretData,
+		}
+	}
+
+	var seeds []string
+	for i, mount := range plan.Mounts {
+		readonly := contains(strings.Split(mount.Options, ","), "ro")
+		switch {
+		case mount.Source == "":
+			volume := "anon-" + strconv.Itoa(i)
+			spec.Volumes = append(spec.Volumes, kubeVolume{Name: volume, EmptyDir: &kubeEmptyDir{}})
+			main.VolumeMounts = append(main.VolumeMounts, kubeVolumeMount{Name: volume, MountPath: mount.Target})
+			seeds = append(seeds, volume+":"+mount.Target)
+		case filepath.IsAbs(mount.Source):
+			syncPath := "m" + strconv.Itoa(len(kp.mounts))
+			kp.mounts = append(kp.mounts, &remoteMount{src: mount.Source, dst: mount.Target, readonly: readonly})
+			kp.syncPaths = append(kp.syncPaths, syncPath)
+			main.VolumeMounts = append(main.VolumeMounts, kubeVolumeMount{Name: kubernetesSyncVolume, MountPath: mount.Target, SubPath: syncPath, ReadOnly: readonly})
+		default:
+			if !kubernetesNamePattern.MatchString(mount.Source) || len(mount.Source) > 63 {
+				return nil, fmt.Errorf("volume %q cannot be a Kubernetes PersistentVolumeClaim: use lowercase letters, digits and dashes", mount.Source)
+			}
+			kp.claims = append(kp.claims, newKubernetesClaim(cfg, mount.Source))
+			spec.Volumes = append(spec.Volumes, kubeVolume{Name: mount.Source, PersistentVolumeClaim: &kubeClaimSource{ClaimName: mount.Source}})
+			main.VolumeMounts = append(main.VolumeMounts, kubeVolumeMount{Name: mount.Source, MountPath: mount.Target, ReadOnly: readonly})
+			if !readonly {
+				seeds = append(seeds, mount.Source+":"+mount.Target)
+			}
+		}
+	}
+
+	for _, flag := range plan.Flags {
+		switch flag.Name {
+		case "--rm", "--name":
+		case "-it":
+			kp.stdin, kp.tty = true, true
+		case "-i":
+			kp.stdin = true
+		case "-t":
+			kp.tty = true
+		case "-w":
+			main.WorkingDir = flag.Value
+		case "--runtime":
+			spec.RuntimeClassName = flag.Value
+		case "--cpus":
+			setKubernetesResource(&main, "cpu", flag.Value)
+		case "--memory":
+			setKubernetesResource(&main, "memory", kubernetesSize(flag.Value))
+		case "--shm-size":
+			spec.Volumes = append(spec.Volumes, kubeVolume{Name: "dshm", EmptyDir: &kubeEmptyDir{Medium: "Memory", SizeLimit: kubernetesSize(flag.Value)}})
+			main.VolumeMounts = append(main.VolumeMounts, kubeVolumeMount{Name: "dshm", MountPath: "/dev/shm"})
+		case "--cap-add", "--cap-drop":
+			if main.SecurityContext == nil {
+				main.SecurityContext = &kubeContainerSecurity{}
+			}
+			capability := strings.TrimPrefix(strings.ToUpper(flag.Value), "CAP_")
+			if flag.Name == "--cap-add" {
+				main.SecurityContext.Capabilities.Add = append(main.SecurityContext.Capabilities.Add, capability)
+			} else {
+				main.SecurityContext.Capabilities.Drop = append(main.SecurityContext.Capabilities.Drop, capability)
+			}
+		case "--add-host":
+			host, ip, ok := strings.Cut(flag.Value, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid --add-host %q", flag.Value)
+			}
+			spec.HostAliases = append(spec.HostAliases, kubeHostAlias{IP: ip, Hostnames: []string{host}})
+		case "--dns", "--dns-search":
+			if spec.DNSConfig == nil {
+				spec.DNSConfig = &kubeDNSConfig{}
+			}
+			if flag.Name == "--dns" {
+				// Cluster DNS is replaced, as --dns replaces the engine's.
+				spec.DNSPolicy = "None"
+				spec.DNSConfig.Nameservers = append(spec.DNSConfig.Nameservers, flag.Value)
+			} else {
+				spec.DNSConfig.Searches = append(spec.DNSConfig.Searches, flag.Value)
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported with Kubernetes runtime", flag.Name)
+		}
+	}
+
+	spec.InitContainers = []kubeContainer{newKubernetesSyncContainer(plan.Image, seeds)}
+	spec.Containers = []kubeContainer{main}
+	kp.pod = kubeObject{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Metadata: kubeMeta{
+			Name:        name,
+			Labels:      map[string]string{kubernetesManagedBy: "yolobox"},
+			Annotations: map[string]string{"kubectl.kubernetes.io/default-container": kubernetesContainer},
+		},
+		Spec: spec,
+	}
+	return kp, nil
+}
+
+// parseKubernetesRunArgs splits run args like parseRunArgs, but takes flag
+// values from kubernetesRunFlags, so a value starting with a dash is still a
+// value, and fails on flags it does not know.
+func parseKubernetesRunArgs(args, command []string) (dryRunPlan, error) {
+	imageIndex := len(args) - len(command) - 1
+	if imageIndex < 1 {
+		return dryRunPlan{}, fmt.Errorf("no image in run args")
+	}
+	plan := dryRunPlan{Runtime: "kubernetes", Image: args[imageIndex], Command: command, Args: args}
+	for i := 1; i < imageIndex; i++ {
+		name, value, inline := strings.Cut(args[i], "=")
+		if !strings.HasPrefix(name, "--") {
+			name, value, inline = args[i], "", false
+		}
+		takesValue, ok := kubernetesRunFlags[name]
+		switch {
+		case !ok:
+			return dryRunPlan{}, fmt.Errorf("%s is not supported with Kubernetes runtime", name)
+		case takesValue && !inline:
+			if i+1 >= imageIndex {
+				return dryRunPlan{}, fmt.Errorf("%s needs a value", name)
+			}
+			i++
+			value = args[i]
+		case !takesValue && inline:
+			return dryRunPlan{}, fmt.Errorf("%s does not take a value", name)
+		}
+		plan.add(name, value)
+	}
+	return plan, nil
+}
+
+// newKubernetesSyncContainer returns the init container that seeds empty
+// volumes from the image, as Docker does for a new volume, then waits for
+// the host paths to be copied into the sync volume. seeds are VOLUME:PATH.
+func newKubernetesSyncContainer(image string, seeds []string) kubeContainer {
+	script := []string{`seed() { [ -n "$(ls -A "$2" | grep -vx lost+found)" ] || cp -a "$1"/. "$2"/ 2>/dev/null || true; }`}
+	mounts := []kubeVolumeMount{{Name: kubernetesSyncVolume, MountPath: kubernetesSyncDir}}
+	for _, seed := range seeds {
+		volume, target, _ := strings.Cut(seed, ":")
+		dir := path.Join(kubernetesSeedDir, volume)
+		mounts = append(mounts, kubeVolumeMount{Name: volume, MountPath: dir})
+		script = append(script, "seed "+shellQuote(target)+" "+shellQuote(dir))
+	}
+	script = append(script, "until [ -e "+kubernetesSyncDir+"/.ready ]; do sleep 1; done")
+	return kubeContainer{
+		Name:         kubernetesSyncContainer,
+		Image:        image,
+		Command:      []string{"sh", "-c", strings.Join(script, "\n")},
+		VolumeMounts: mounts,
+	}
+}
+
+func newKubernetesClaim(cfg Config, name string) kubeObject {
+	size := cfg.Kubernetes.VolumeSize
+	if size == "" {
+		size = defaultKubernetesVolumeSize
+	}
+	return kubeObject{
+		APIVersion: "v1",
+		Kind:       "PersistentVolumeClaim",
+		Metadata:   kubeMeta{Name: name, Labels: map[string]string{kubernetesManagedBy: "yolobox"}},
+		Spec: kubeClaimSpec{
+			AccessModes:      []string{"ReadWriteOnce"},
+			StorageClassName: cfg.Kubernetes.StorageClass,
+			Resources:        kubeResources{Requests: map[string]string{"storage": size}},
+		},
+	}
+}
+
+// setKubernetesResource requests what the container is limited to, so the
+// scheduler places it where the whole amount is free.
+func setKubernetesResource(c *kubeContainer, name, value string) {
+	if c.Resources == nil {
+		c.Resources = &kubeResources{Requests: map[string]string{}, Limits: map[string]string{}}
+	}
+	c.Resources.Requests[name] = value
+	c.Resources.Limits[name] = value
+}
+
+// kubernetesSize converts a Docker size, where 512m means 512 MiB, to a
+// Kubernetes quantity, where m means milli.
+func kubernetesSize(size string) string {
+	number := strings.TrimRight(size, "kKmMgGtTpPiIbB")
+	unit := strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(size[len(number):]), "b"), "i"))
+	if unit == "" {
+		return number
+	}
+	return number + unit + "i"
+}
+
+// objects returns everything created for the run in the order it is
+// created: claims, the pod, then the Secret the pod owns.
+func (kp *kubernetesPod) objects() []kubeObject {
+	objects := append(append([]kubeObject{}, kp.claims...), kp.pod)
+	if kp.secret != nil {
+		objects = append(objects, *kp.secret)
+	}
+	return objects
+}
+
+// execArgs are the kubectl args that run the command in the main container
+// with the environment the entrypoint set up.
+func (kp *kubernetesPod) execArgs() []string {
+	args := []string{"exec"}
+	if kp.stdin {
+		args = append(args, "-i")
+	}
+	if kp.tty {
+		args = append(args, "-t")
+	}
+	args = append(args, kp.name, "-c", kubernetesContainer, "--", "sh", "-c", `. `+kubernetesEnvFile+` && exec "$@"`, "yolobox")
+	return append(args, kp.command...)
+}
+
+// redacted returns the objects with secret values replaced, for --dry-run.
+func (kp *kubernetesPod) redacted() []kubeObject {
+	objects := kp.objects()
+	for i := range objects {
+		if objects[i].StringData == nil {
+			continue
+		}
+		data := map[string]string{}
+		for key := range objects[i].StringData {
+			data[key] = redactedValue
+		}
+		objects[i].StringData = data
+	}
+	return objects
+}
+
+// printKubernetesDryRun prints the objects runKubernetes would create and
+// the exec it would attach to.
+func printKubernetesDryRun(mode string, kp *kubernetesPod) error {
+	if mode == "json" {
+		data, err := json.MarshalIndent(struct {
+			Runtime string       `json:"runtime"`
+			Objects []kubeObject `json:"objects"`
+			Exec    []string     `json:"exec"`
+		}{"kubernetes", kp.redacted(), kp.execArgs()}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, object := range kp.redacted() {
+		data, err := json.MarshalIndent(object, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("kubectl create -f - <<'EOF'\n%s\nEOF\n", data)
+	}
+	fmt.Println(shellLine("kubectl", kp.execArgs()))
+	return nil
+}
+
+// runKubernetes runs args as a pod. Named volumes are created as claims if
+// missing, host paths are copied into the pod before the main container
+// starts, the command runs through exec, and writable host paths are
+// copied back after it exits. The pod and its Secret are deleted on exit,
+// and the Secret is owned by the pod, so the cluster deletes it along with
+// a pod that outlives yolobox.
+func runKubernetes(rt Runtime, cfg Config, projectDir string, args, command []string) error {
+	absProject, err := filepath.Abs(projectDir)
+	if err != nil {
+		return err
+	}
+	kp, err := newKubernetesPod(cfg, args, command)
+	if err != nil {
+		return err
+	}
+	project, err := remoteProject(cfg, absProject, kp.mounts)
+	if err != nil {
+		return err
+	}
+
+	for _, claim := range kp.claims {
+		output, err := createKubernetesObject(rt, claim)
+		if err != nil && !strings.Contains(string(output), "AlreadyExists") {
+			return fmt.Errorf("failed to create volume %s: %s", claim.Metadata.Name, strings.TrimSpace(string(output)))
+		}
+	}
+
+	// Interrupts are caught so the pod is always deleted: Ctrl-C also
+	// reaches the kubectl yolobox is running, which then fails, and an
+	// interrupt while waiting for the pod aborts the start.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if output, err := createKubernetesObject(rt, kp.pod); err != nil {
+		return fmt.Errorf("failed to create pod %s: %s", kp.name, strings.TrimSpace(string(output)))
+	}
+	defer func() {
+		deleteArgs := []string{"delete", "pod/" + kp.name}
+		if kp.secret != nil {
+			deleteArgs = append(deleteArgs, "secret/"+kp.secret.Metadata.Name)
+		}
+		_, _ = rt.CombinedOutput(append(deleteArgs, "--ignore-not-found", "--wait=false")...)
+	}()
+	if kp.secret != nil {
+		// The main container waits for the sync, so the Secret it reads
+		// exists long before it starts.
+		uid, err := rt.Output("get", "pod", kp.name, "-o", "jsonpath={.metadata.uid}")
+		if err != nil {
+			return fmt.Errorf("failed to look up pod %s: %w", kp.name, err)
+		}
+		secret := *kp.secret
+		secret.Metadata.OwnerReferences = []kubeOwnerReference{{APIVersion: "v1", Kind: "Pod", Name: kp.name, UID: strings.TrimSpace(string(uid))}}
+		if output, err := createKubernetesObject(rt, secret); err != nil {
+			return fmt.Errorf("failed to create secret %s: %s", secret.Metadata.Name, strings.TrimSpace(string(output)))
+		}
+	}
+
+	info("Starting pod %s on %s", kp.name, cfg.RemoteHost)
+	if err := waitForKubernetesSync(rt, kp.name, signals); err != nil {
+		return err
+	}
+	info("Copying %s to %s", absProject, cfg.RemoteHost)
+	if err := pushRemoteMounts(rt, kp.name+":"+kubernetesSyncContainer, kubernetesSyncDir, kp.mounts, kp.syncPaths); err != nil {
+		return fmt.Errorf("failed to copy files to %s: %w", cfg.RemoteHost, err)
+	}
+	if output, err := rt.CombinedOutput("exec", kp.name, "-c", kubernetesSyncContainer, "--", "touch", kubernetesSyncDir+"/.ready"); err != nil {
+		return fmt.Errorf("failed to start pod %s: %s", kp.name, strings.TrimSpace(string(output)))
+	}
+	if output, err := rt.CombinedOutput("wait", "--for=condition=Ready", "pod/"+kp.name, "--timeout="+kubernetesStartTimeout.String()); err != nil {
+		return fmt.Errorf("pod %s did not become ready: %s", kp.name, strings.TrimSpace(string(output)))
+	}
+
+	var stopSync func()
+	if cfg.RemoteSync == "live" && project != nil && !project.readonly {
+		stopSync = startLiveSync(rt, kp.name, project)
+	}
+	runErr := rt.Run(kp.execArgs()...)
+	if stopSync != nil {
+		stopSync()
+	}
+	pullRemoteMounts(rt, kp.name, cfg.RemoteHost, kp.mounts)
+	return runErr
+}
+
+// createKubernetesObject runs kubectl create on object, written to a temp
+// file so secret values stay off the command line.
+func createKubernetesObject(rt Runtime, object kubeObject) ([]byte, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "yolobox-kubernetes-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return rt.CombinedOutput("create", "-f", f.Name())
+}
+
+// waitForKubernetesSync waits until the sync init container is running, so
+// the host paths can be copied in. Image pull and config errors fail fast
+// instead of waiting out the timeout, as does a signal on signals.
+func waitForKubernetesSync(rt Runtime, name string, signals <-chan os.Signal) error {
+	deadline := time.Now().Add(kubernetesStartTimeout)
+	status := "jsonpath={.status.phase}|{.status.initContainerStatuses[0].state.running.startedAt}|" +
+		"{.status.initContainerStatuses[0].state.waiting.reason}|{.status.initContainerStatuses[0].state.waiting.message}"
+	for {
+		select {
+		case <-signals:
+			return fmt.Errorf("interrupted while waiting for pod %s to start", name)
+		default:
+		}
+		output, err := rt.Output("get", "pod", name, "-o", status)
+		if err == nil {
+			fields := strings.SplitN(strings.TrimSpace(string(output)), "|", 4)
+			for len(fields) < 4 {
+				fields = append(fields, "")
+			}
+			phase, running, reason, message := fields[0], fields[1], fields[2], fields[3]
+			switch {
+			case running != "":
+				return nil
+			case phase == "Failed":
+				return fmt.Errorf("pod %s failed to start", name)
+			case contains(kubernetesStartFailures, reason):
+				return fmt.Errorf("pod %s cannot start: %s: %s", name, reason, message)
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for pod %s to start", name)
+		}
+		time.Sleep(kubernetesPollInterval)
+	}
+}
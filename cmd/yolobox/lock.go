@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const lockFileName = ".yolobox.lock"
+
+const lockHeader = "# Generated by yolobox lock. Commit it so everyone runs the same image;\n# refresh it with yolobox lock --update.\n\n"
+
+// imageLock is the .yolobox.lock file. It pins the configured image to a
+// registry digest and records the custom image inputs it was taken with.
+type imageLock struct {
+	Image     string         `toml:"image"`
+	Digest    string         `toml:"digest"`
+	Customize *customizeLock `toml:"customize,omitempty"`
+}
+
+// customizeLock records the inputs of the custom image built on top of the
+// pinned image.
+type customizeLock struct {
+	// BaseID is the image ID customImageTag hashes.
+	BaseID         string   `toml:"base_id"`
+	Packages       []string `toml:"packages"`
+	FragmentSHA256 string   `toml:"fragment_sha256,omitempty"`
+}
+
+// lockCommand implements `yolobox lock [--update]`.
+func lockCommand(args []string, projectDir string) error {
+	update := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "--update" || arg == "-update" {
+			update = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	cfg, extra, err := parseBaseFlags("lock", rest, projectDir)
+	if err != nil {
+		return err
+	}
+	if len(extra) != 0 {
+		return fmt.Errorf("unexpected args: %v", extra)
+	}
+
+	path := filepath.Join(projectDir, lockFileName)
+	existing, err := readImageLock(path)
+	if err != nil {
+		return err
+	}
+	if existing != nil && !update {
+		return fmt.Errorf("%s already pins %s; run yolobox lock --update to refresh it", lockFileName, existing.Digest)
+	}
+
+	rt, err := loadRuntime(cfg.Runtime)
+	if err != nil {
+		return err
+	}
+	if rt.Capabilities().PodSpec || rt.RemoteHost() != "" {
+		return fmt.Errorf("yolobox lock resolves the image with a local engine, not %s", rt.DisplayName())
+	}
+	if update && !strings.Contains(cfg.Image, "@") {
+		info("Pulling %s...", cfg.Image)
+		if err := rt.Run("pull", cfg.Image); err != nil {
+			return fmt.Errorf("failed to pull image: %w", err)
+		}
+	}
+	lock, err := newImageLock(cfg, rt, projectDir)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(lockHeader)
+	if err := toml.NewEncoder(&buf).Encode(lock); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", lockFileName, err)
+	}
+	if existing != nil && existing.Digest == lock.Digest && reflect.DeepEqual(existing.Customize, lock.Customize) {
+		success("%s is up to date (%s)", lockFileName, lock.Digest)
+		return nil
+	}
+	success("Pinned %s to %s", lock.Image, lock.Digest)
+	return nil
+}
+
+// newImageLock resolves cfg.Image, pulling it when it is missing, and
+// records the custom image inputs.
+func newImageLock(cfg Config, rt Runtime, projectDir string) (*imageLock, error) {
+	baseID, err := inspectImageID(rt, cfg.Image)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := imageDigest(rt, cfg.Image)
+	if err != nil {
+		return nil, err
+	}
+	lock := &imageLock{Image: cfg.Image, Digest: digest}
+	if hasCustomization(cfg) {
+		fragmentHash, err := customizeFragmentHash(cfg, projectDir)
+		if err != nil {
+			return nil, err
+		}
+		lock.Customize = &customizeLock{
+			BaseID:         baseID,
+			Packages:       normalizePackages(cfg.Customize.Packages),
+			FragmentSHA256: fragmentHash,
+		}
+	}
+	return lock, nil
+}
+
+// imageDigest returns the repo@sha256 reference of a local image, taken from
+// the digests the engine recorded when it pulled the image.
+func imageDigest(rt Runtime, image string) (string, error) {
+	if strings.Contains(image, "@") {
+		return image, nil
+	}
+	output, err := rt.Output("image", "inspect", image, "--format", "{{json .RepoDigests}}")
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %q: %w", image, err)
+	}
+	var digests []string
+	if err := json.Unmarshal(bytes.TrimSpace(output), &digests); err != nil {
+		return "", fmt.Errorf("failed to parse digests of image %q: %w", image, err)
+	}
+	if len(digests) == 0 {
+		return "", fmt.Errorf("image %q has no registry digest; lock an image pulled from a registry", image)
+	}
+	repo := imageRepository(image)
+	for _, d := range digests {
+		name, _, _ := strings.Cut(d, "@")
+		if name == repo || strings.HasSuffix(name, "/"+repo) {
+			return d, nil
+		}
+	}
+	return digests[0], nil
+}
+
+// imageRepository strips the tag from an image reference.
+func imageRepository(image string) string {
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon]
+	}
+	return image
+}
+
+func customizeFragmentHash(cfg Config, projectDir string) (string, error) {
+	path, err := resolveCustomizeFile(cfg.Customize.Dockerfile, projectDir)
+	if err != nil {
+		return "", err
+	}
+	fragment, err := loadCustomizeFragment(path)
+	if err != nil || fragment == "" {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(fragment))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readImageLock returns nil when there is no lock file.
+func readImageLock(path string) (*imageLock, error) {
+	var lock imageLock
+	if _, err := toml.DecodeFile(path, &lock); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to parse %s: %w", lockFileName, err)
+	}
+	if lock.Image == "" || !strings.Contains(lock.Digest, "@sha256:") {
+		return nil, fmt.Errorf("%s has no image digest; run yolobox lock --update", lockFileName)
+	}
+	return &lock, nil
+}
+
+// applyImageLock swaps cfg.Image for the digest pinned in the project's
+// lock file. A lock taken for another image is ignored, and one whose
+// custom image inputs changed still pins the base image, with a warning.
+func applyImageLock(cfg *Config, projectDir string) error {
+	lock, err := readImageLock(filepath.Join(projectDir, lockFileName))
+	if err != nil || lock == nil {
+		return err
+	}
+	if lock.Image != cfg.Image {
+		warn("Ignoring %s: it pins %s, but the image is %s (run yolobox lock --update)", lockFileName, lock.Image, cfg.Image)
+		return nil
+	}
+	if stale, err := lockStale(lock, *cfg, projectDir); err != nil {
+		return err
+	} else if stale != "" {
+		warn("%s is stale: %s changed since it was written (run yolobox lock --update)", lockFileName, stale)
+	}
+	cfg.Image = lock.Digest
+	return nil
+}
+
+// lockStale names the custom image input that no longer matches the lock,
+// or returns "" when none changed.
+func lockStale(lock *imageLock, cfg Config, projectDir string) (string, error) {
+	if !hasCustomization(cfg) {
+		if lock.Customize != nil {
+			return "customize", nil
+		}
+		return "", nil
+	}
+	if lock.Customize == nil {
+		return "customize", nil
+	}
+	if !reflect.DeepEqual(normalizePackages(lock.Customize.Packages), normalizePackages(cfg.Customize.Packages)) {
+		return "customize.packages", nil
+	}
+	fragmentHash, err := customizeFragmentHash(cfg, projectDir)
+	if err != nil {
+		return "", err
+	}
+	if fragmentHash != lock.Customize.FragmentSHA256 {
+		return "customize.dockerfile", nil
+	}
+	return "", nil
+}
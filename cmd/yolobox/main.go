@@ -10,7 +10,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
 	"syscall"
@@ -154,6 +153,16 @@ func runCmd() error {
 			return err
 		}
 		return printConfig(cfg)
+	case "netlog":
+		return netlogCommand(args[1:])
+	case "ports":
+		return portsCommand(args[1:])
+	case "doctor":
+		return doctorCommand(args[1:], projectDir)
+	case "lock":
+		return lockCommand(args[1:], projectDir)
+	case "generate":
+		return generateCommand(args[1:], projectDir)
 	case "reset":
 		return resetVolumes(args[1:])
 	case "uninstall":
@@ -180,7 +189,9 @@ func runCmd() error {
 			allToolArgs := append(rest, toolArgs...)
 
 			// Print logo before running tool
-			fmt.Fprint(os.Stderr, colorCyan+logo+colorReset)
+			if cfg.DryRun == "" {
+				fmt.Fprint(os.Stderr, colorCyan+logo+colorReset)
+			}
 			// Build command: tool name + any tool args
 			command := append([]string{toolName}, allToolArgs...)
 			return runCommand(cfg, command, false)
@@ -219,6 +230,11 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "  yolobox setup               Configure yolobox settings")
 	fmt.Fprintln(os.Stderr, "  yolobox upgrade             Upgrade binary and pull latest image")
 	fmt.Fprintln(os.Stderr, "  yolobox config              Print resolved configuration")
+	fmt.Fprintln(os.Stderr, "  yolobox netlog [session]    Summarize a session's network log")
+	fmt.Fprintln(os.Stderr, "  yolobox ports [session]     Show a session's published ports")
+	fmt.Fprintln(os.Stderr, "  yolobox doctor [--json]     Check the runtime and host setup")
+	fmt.Fprintln(os.Stderr, "  yolobox lock [--update]     Pin the image to a digest in .yolobox.lock")
+	fmt.Fprintln(os.Stderr, "  yolobox generate systemd --name <name> <cmd...>  Write a quadlet or systemd unit")
 	fmt.Fprintln(os.Stderr, "  yolobox reset --force       Remove named volumes (fresh start)")
 	fmt.Fprintln(os.Stderr, "  yolobox uninstall --force   Uninstall yolobox completely")
 	fmt.Fprintln(os.Stderr, "  yolobox version             Show version info")
@@ -230,7 +246,9 @@ func printUsage() {
 	}
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintf(os.Stderr, "%sFLAGS:%s\n", colorBold, colorReset)
-	fmt.Fprintln(os.Stderr, "  --runtime <name>      Container runtime: docker, podman, or container")
+	fmt.Fprintln(os.Stderr, "  --runtime <name>      Container runtime: docker, podman, nerdctl, container, or kubernetes")
+	fmt.Fprintln(os.Stderr, "  --isolation <level>   Sandbox isolation: default, gvisor, or kata")
+	fmt.Fprintln(os.Stderr, "  --remote-sync <mode>  Project sync with a remote engine: exit or live")
 	fmt.Fprintln(os.Stderr, "  --image <name>        Base image to use")
 	fmt.Fprintln(os.Stderr, "  --pod <name>          Join existing Podman pod (shares its network)")
 	fmt.Fprintln(os.Stderr, "  --setup               Run interactive setup before starting")
@@ -239,16 +257,32 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "  --copy-as <src:dst>   Mount a file at a project path inside the container")
 	fmt.Fprintln(os.Stderr, "  --env <KEY=val>       Set environment variable (repeatable)")
 	fmt.Fprintln(os.Stderr, "  --ssh-agent           Forward SSH agent socket")
+	fmt.Fprintln(os.Stderr, "  --ssh-agent-key <filter>  Only expose matching agent keys (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --ssh-agent-confirm   Approve each SSH signature on the host")
 	fmt.Fprintln(os.Stderr, "  --no-network          Disable network access (default: network enabled)")
+	fmt.Fprintln(os.Stderr, "  --allow-domain <domain>  Only allow egress to this domain or *.domain (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --host-service <name:port>  Reach a host port at host.yolobox.internal (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --publish <port>      Publish [host:]container port on localhost (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --network-log         Record proxied outbound connections (see yolobox netlog)")
+	fmt.Fprintln(os.Stderr, "  --dns <ip>            Use a custom DNS server (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --dns-search <domain> Add a DNS search domain (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --add-host <host:ip>  Add an /etc/hosts entry (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --ca-certificate <path>  Trust an extra CA certificate (repeatable)")
+	fmt.Fprintln(os.Stderr, "  --proxy-passthrough   Forward HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the host")
 	fmt.Fprintln(os.Stderr, "  --network <name>      Join container network (e.g., docker compose network)")
+	fmt.Fprintln(os.Stderr, "  --compose             Join the running compose project's default network")
 	fmt.Fprintln(os.Stderr, "  --no-yolo             Disable AI CLIs YOLO mode")
 	fmt.Fprintln(os.Stderr, "  --scratch             Fresh environment, no persistent volumes")
 	fmt.Fprintln(os.Stderr, "  --readonly-project    Mount project directory read-only")
 	fmt.Fprintln(os.Stderr, "  --claude-config       Copy host Claude config to container")
 	fmt.Fprintln(os.Stderr, "  --codex-config        Copy host Codex config to container")
+	fmt.Fprintln(os.Stderr, "  --sync-credentials-back  Write refreshed OAuth tokens back to the host")
 	fmt.Fprintln(os.Stderr, "  --gemini-config       Copy host Gemini config to container")
 	fmt.Fprintln(os.Stderr, "  --git-config          Copy host git config to container")
 	fmt.Fprintln(os.Stderr, "  --gh-token            Forward GitHub CLI token (from gh auth token)")
+	fmt.Fprintln(os.Stderr, "  --keyless             Keep API keys on the host, inject them via a proxy")
+	fmt.Fprintln(os.Stderr, "  --git-credentials     Serve git credentials per request from the host (no token in env)")
+	fmt.Fprintln(os.Stderr, "  --git-credential-allow <pattern>  Host or host/owner/repo to serve (repeatable)")
 	fmt.Fprintln(os.Stderr, "  --copy-agent-instructions  Copy global agent instruction files")
 	fmt.Fprintln(os.Stderr, "  --docker              Mount Docker socket and join shared network")
 	fmt.Fprintln(os.Stderr, "  --cpus <count>        Limit number of CPUs (supports fractions)")
@@ -262,6 +296,8 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "  --packages <list>     Comma-separated apt packages for a custom image")
 	fmt.Fprintln(os.Stderr, "  --customize-file <path> Dockerfile fragment for a custom image")
 	fmt.Fprintln(os.Stderr, "  --rebuild-image       Force rebuild of the custom image")
+	fmt.Fprintln(os.Stderr, "  --dry-run[=json]      Print the runtime command instead of running it")
+	fmt.Fprintln(os.Stderr, "  --timings             Report where startup time went")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintf(os.Stderr, "%sCONFIG:%s\n", colorBold, colorReset)
 	fmt.Fprintln(os.Stderr, "  Global:  ~/.config/yolobox/config.toml")
@@ -296,19 +332,37 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 
 	var (
 		runtimeFlag           string
+		isolation             string
+		remoteSync            string
 		imageFlag             string
 		podFlag               string
 		networkFlag           string
+		compose               bool
 		sshAgent              bool
+		sshAgentKeys          stringSliceFlag
+		sshAgentConfirm       bool
 		readonlyProject       bool
 		noNetwork             bool
+		allowDomains          stringSliceFlag
+		networkLog            bool
+		publish               stringSliceFlag
+		hostServices          stringSliceFlag
+		dnsServers            stringSliceFlag
+		dnsSearch             stringSliceFlag
+		addHosts              stringSliceFlag
+		caCertificates        stringSliceFlag
+		proxyPassthrough      bool
 		noYolo                bool
 		scratch               bool
 		claudeConfig          bool
 		codexConfig           bool
+		syncCredentialsBack   bool
 		geminiConfig          bool
 		gitConfig             bool
 		ghToken               bool
+		keyless               bool
+		gitCredentials        bool
+		gitCredentialAllow    stringSliceFlag
 		copyAgentInstructions bool
 		docker                bool
 		setup                 bool
@@ -329,22 +383,42 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 		packages      string
 		customizeFile string
 		rebuildImage  bool
+		dryRun        dryRunFlag
+		timings       bool
 	)
 
 	fs.StringVar(&runtimeFlag, "runtime", "", "container runtime")
+	fs.StringVar(&isolation, "isolation", "", "sandbox isolation: default, gvisor, or kata")
+	fs.StringVar(&remoteSync, "remote-sync", "", "project sync with a remote engine: exit or live")
 	fs.StringVar(&imageFlag, "image", "", "container image")
 	fs.StringVar(&podFlag, "pod", "", "join existing podman pod")
 	fs.StringVar(&networkFlag, "network", "", "container network to join")
+	fs.BoolVar(&compose, "compose", false, "join the default network of the running compose project for this directory")
 	fs.BoolVar(&sshAgent, "ssh-agent", false, "mount SSH agent socket")
+	fs.Var(&sshAgentKeys, "ssh-agent-key", "only expose SSH agent keys matching SHA256:<fp> or comment:<glob> (repeatable)")
+	fs.BoolVar(&sshAgentConfirm, "ssh-agent-confirm", false, "require host approval for each SSH signature")
 	fs.BoolVar(&readonlyProject, "readonly-project", false, "mount project read-only")
 	fs.BoolVar(&noNetwork, "no-network", false, "disable network")
+	fs.Var(&allowDomains, "allow-domain", "only allow egress to this domain or *.domain (repeatable)")
+	fs.Var(&hostServices, "host-service", "expose a host port as host.yolobox.internal: name:port (repeatable)")
+	fs.Var(&publish, "publish", "publish a container port: [host:]container[/udp] (repeatable)")
+	fs.BoolVar(&networkLog, "network-log", false, "record proxied outbound connections in the session's network log")
+	fs.Var(&dnsServers, "dns", "custom DNS server IP (repeatable)")
+	fs.Var(&dnsSearch, "dns-search", "DNS search domain (repeatable)")
+	fs.Var(&addHosts, "add-host", "add an /etc/hosts entry: hostname:ip (repeatable)")
+	fs.Var(&caCertificates, "ca-certificate", "PEM CA certificate to trust inside the container (repeatable)")
+	fs.BoolVar(&proxyPassthrough, "proxy-passthrough", false, "forward host HTTP_PROXY/HTTPS_PROXY/NO_PROXY")
 	fs.BoolVar(&noYolo, "no-yolo", false, "disable AI CLIs YOLO mode")
 	fs.BoolVar(&scratch, "scratch", false, "fresh environment, no persistent volumes")
 	fs.BoolVar(&claudeConfig, "claude-config", false, "copy host Claude config to container")
 	fs.BoolVar(&codexConfig, "codex-config", false, "copy host Codex config to container")
+	fs.BoolVar(&syncCredentialsBack, "sync-credentials-back", false, "write refreshed OAuth credentials back to the host")
 	fs.BoolVar(&geminiConfig, "gemini-config", false, "copy host Gemini config to container")
 	fs.BoolVar(&gitConfig, "git-config", false, "copy host git config to container")
 	fs.BoolVar(&ghToken, "gh-token", false, "forward GitHub CLI token (from gh auth token)")
+	fs.BoolVar(&keyless, "keyless", false, "keep API keys on the host and inject them through a local proxy")
+	fs.BoolVar(&gitCredentials, "git-credentials", false, "serve git credentials from the host for allowlisted repos")
+	fs.Var(&gitCredentialAllow, "git-credential-allow", "host or host/owner/repo the git credential bridge may answer for (repeatable)")
 	fs.BoolVar(&copyAgentInstructions, "copy-agent-instructions", false, "copy agent instruction files (CLAUDE.md, GEMINI.md, AGENTS.md)")
 	fs.BoolVar(&docker, "docker", false, "mount Docker socket and join shared network")
 	fs.BoolVar(&setup, "setup", false, "run interactive setup before starting")
@@ -365,6 +439,8 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	fs.StringVar(&packages, "packages", "", "comma-separated apt packages for a custom image")
 	fs.StringVar(&customizeFile, "customize-file", "", "path to a Dockerfile fragment for a custom image")
 	fs.BoolVar(&rebuildImage, "rebuild-image", false, "force rebuild of the custom image")
+	fs.Var(&dryRun, "dry-run", "print the runtime command instead of running it (--dry-run=json for JSON)")
+	fs.BoolVar(&timings, "timings", false, "report where startup time went")
 
 	if err := fs.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -377,6 +453,12 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	if runtimeFlag != "" {
 		cfg.Runtime = runtimeFlag
 	}
+	if isolation != "" {
+		cfg.Isolation = isolation
+	}
+	if remoteSync != "" {
+		cfg.RemoteSync = remoteSync
+	}
 	if imageFlag != "" {
 		cfg.Image = imageFlag
 	}
@@ -386,15 +468,52 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	if sshAgent {
 		cfg.SSHAgent = true
 	}
+	if len(sshAgentKeys) > 0 {
+		cfg.SSHAgent = true
+		cfg.SSHAgentKeys = append(cfg.SSHAgentKeys, sshAgentKeys...)
+	}
+	if sshAgentConfirm {
+		cfg.SSHAgentConfirm = true
+	}
 	if readonlyProject {
 		cfg.ReadonlyProject = true
 	}
 	if noNetwork {
 		cfg.NoNetwork = true
 	}
+	if len(allowDomains) > 0 {
+		cfg.AllowDomains = append(cfg.AllowDomains, allowDomains...)
+	}
+	if networkLog {
+		cfg.NetworkLog = true
+	}
+	if len(publish) > 0 {
+		cfg.Ports = append(cfg.Ports, publish...)
+	}
+	if len(hostServices) > 0 {
+		cfg.HostServices = append(cfg.HostServices, hostServices...)
+	}
+	if len(dnsServers) > 0 {
+		cfg.DNS = append(cfg.DNS, dnsServers...)
+	}
+	if len(dnsSearch) > 0 {
+		cfg.DNSSearch = append(cfg.DNSSearch, dnsSearch...)
+	}
+	if len(addHosts) > 0 {
+		cfg.AddHosts = append(cfg.AddHosts, addHosts...)
+	}
+	if len(caCertificates) > 0 {
+		cfg.CACertificates = append(cfg.CACertificates, caCertificates...)
+	}
+	if proxyPassthrough {
+		cfg.ProxyPassthrough = true
+	}
 	if networkFlag != "" {
 		cfg.Network = networkFlag
 	}
+	if compose {
+		cfg.Compose = true
+	}
 	if noYolo {
 		cfg.NoYolo = true
 	}
@@ -407,6 +526,9 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	if codexConfig {
 		cfg.CodexConfig = true
 	}
+	if syncCredentialsBack {
+		cfg.SyncCredentialsBack = true
+	}
 	if geminiConfig {
 		cfg.GeminiConfig = true
 	}
@@ -416,6 +538,16 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	if ghToken {
 		cfg.GhToken = true
 	}
+	if keyless {
+		cfg.Keyless = true
+	}
+	if gitCredentials {
+		cfg.GitCredentials.Enabled = true
+	}
+	if len(gitCredentialAllow) > 0 {
+		cfg.GitCredentials.Enabled = true
+		cfg.GitCredentials.Allow = append(cfg.GitCredentials.Allow, gitCredentialAllow...)
+	}
 	if copyAgentInstructions {
 		cfg.CopyAgentInstructions = true
 	}
@@ -472,6 +604,12 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	if rebuildImage {
 		cfg.RebuildImage = true
 	}
+	if dryRun != "" {
+		cfg.DryRun = string(dryRun)
+	}
+	if timings {
+		cfg.Timings = true
+	}
 
 	// Validate conflicting options after config + CLI values have been merged.
 	if err := validateConfigConflicts(cfg); err != nil {
@@ -486,6 +624,42 @@ func parseBaseFlags(name string, args []string, projectDir string) (Config, []st
 	if err := validateProjectFilteringConfig(cfg, projectDir); err != nil {
 		return cfg, nil, err
 	}
+	if err := validateCACertificates(cfg, projectDir); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateGitCredentialsConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateSSHAgentKeys(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateEgressConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validatePorts(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateHostServices(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateDNSConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateServices(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateComposeConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateIsolationConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateRemoteSync(cfg); err != nil {
+		return cfg, nil, err
+	}
+	if err := validateKubernetesConfig(cfg); err != nil {
+		return cfg, nil, err
+	}
 
 	return cfg, fs.Args(), nil
 }
@@ -497,6 +671,17 @@ func validateConfigConflicts(cfg Config) error {
 	if cfg.Docker && cfg.NoNetwork {
 		return fmt.Errorf("cannot use --docker with --no-network")
 	}
+	if len(cfg.Ports) > 0 {
+		if cfg.NoNetwork {
+			return fmt.Errorf("cannot use ports with --no-network")
+		}
+		if cfg.Pod != "" {
+			return fmt.Errorf("cannot use ports with --pod (publish them on the pod instead)")
+		}
+		if len(cfg.AllowDomains) > 0 {
+			return fmt.Errorf("cannot use ports with allow_domains")
+		}
+	}
 	if cfg.Pod != "" {
 		if cfg.Network != "" {
 			return fmt.Errorf("cannot use --pod with --network")
@@ -512,15 +697,60 @@ func validateConfigConflicts(cfg Config) error {
 }
 
 func validateRuntimeConstraints(cfg Config) error {
-	if cfg.Pod == "" {
+	rt, err := loadRuntime(cfg.Runtime)
+	if err != nil {
+		if cfg.Pod != "" {
+			return err
+		}
+		// Missing runtimes are reported when the container starts.
 		return nil
 	}
+	return validateRuntimeCapabilities(cfg, rt)
+}
 
-	runtimePath, err := resolveRuntime(cfg.Runtime)
-	if err != nil {
-		return err
+// hostSocketFeature names the first option that mounts a Unix socket
+// created on the host, or returns "". Plain --ssh-agent is not one: it uses
+// the socket the engine's VM provides.
+func hostSocketFeature(cfg Config) string {
+	switch {
+	case cfg.SSHAgent && len(cfg.SSHAgentKeys) > 0:
+		return "ssh_agent_keys"
+	case cfg.GitCredentials.Enabled:
+		return "--git-credentials"
+	case cfg.Keyless:
+		return "--keyless"
+	case len(cfg.AllowDomains) > 0:
+		return "allow_domains"
+	case cfg.NetworkLog:
+		return "network_log"
+	case len(cfg.HostServices) > 0:
+		return "host_services"
 	}
-	if filepath.Base(runtimePath) != "podman" {
+	return ""
+}
+
+// validateRuntimeCapabilities rejects options the runtime cannot provide.
+// The host-side bridges and proxies all mount a Unix socket.
+func validateRuntimeCapabilities(cfg Config, rt Runtime) error {
+	caps := rt.Capabilities()
+	name := rt.DisplayName()
+	if feature := hostSocketFeature(cfg); feature != "" && caps.FileMounts && rt.RemoteHost() == "" && !hostSocketsReachable(rt) {
+		return fmt.Errorf("%s is not supported with %s on this machine: it mounts a Unix socket from the host, and the engine's VM file sharing cannot carry sockets", feature, name)
+	}
+	switch {
+	case cfg.GitCredentials.Enabled && !caps.FileMounts:
+		return fmt.Errorf("--git-credentials is not supported with %s runtime", name)
+	case len(cfg.SSHAgentKeys) > 0 && !caps.FileMounts:
+		return fmt.Errorf("ssh_agent_keys is not supported with %s runtime", name)
+	case cfg.Keyless && !caps.FileMounts:
+		return fmt.Errorf("--keyless is not supported with %s runtime", name)
+	case egressProxied(cfg) && !caps.FileMounts:
+		return fmt.Errorf("allow_domains and network_log are not supported with %s runtime", name)
+	case len(cfg.Services) > 0 && !(caps.Labels && caps.Networks):
+		return fmt.Errorf("services are not supported with %s runtime", name)
+	case cfg.Compose && !(caps.Labels && caps.Networks):
+		return fmt.Errorf("--compose is not supported with %s runtime", name)
+	case cfg.Pod != "" && !caps.Pods:
 		return fmt.Errorf("--pod requires the podman runtime (set --runtime podman)")
 	}
 	return nil
@@ -575,6 +805,19 @@ func warnSecurityRelaxations(cfg Config) {
 	warn("Security-impacting runtime flags active (%s). Ensure you trust the workload.", strings.Join(categories, ", "))
 }
 
+// shouldPassthroughEnv reports whether an auto-forwarded env var should reach
+// the container. GitHub tokens stay on the host when the git credential bridge
+// is serving them, and API keys stay on the host in keyless mode.
+func shouldPassthroughEnv(cfg Config, key string) bool {
+	if cfg.GitCredentials.Enabled && (key == "GH_TOKEN" || key == "GITHUB_TOKEN") {
+		return false
+	}
+	if cfg.Keyless && keylessProxiedEnv(key) {
+		return false
+	}
+	return true
+}
+
 func runtimeArgsContainUnconfined(args []string) bool {
 	for _, arg := range args {
 		if strings.Contains(strings.ToLower(arg), "seccomp=unconfined") {
@@ -605,7 +848,9 @@ func runShell(cfg Config) error {
 	}
 
 	// Print logo before entering container
-	fmt.Fprint(os.Stderr, colorCyan+logo+colorReset)
+	if cfg.DryRun == "" {
+		fmt.Fprint(os.Stderr, colorCyan+logo+colorReset)
+	}
 
 	err := runCommand(cfg, []string{"bash"}, true)
 	if err != nil {
@@ -628,31 +873,178 @@ func runCommand(cfg Config, command []string, interactive bool) error {
 		}
 	}
 
-	if err := validateRuntimeConstraints(cfg); err != nil {
+	if err := applyImageLock(&cfg, projectDir); err != nil {
 		return err
 	}
-	if hasCustomization(cfg) {
-		customImage, err := prepareCustomImage(&cfg, projectDir)
-		if err != nil {
+
+	timer := newStartupTimer()
+	timer.mark("config")
+
+	rt, err := loadRuntime(cfg.Runtime)
+	if err != nil {
+		return err
+	}
+	if err := validateRuntimeCapabilities(cfg, rt); err != nil {
+		return err
+	}
+	if host := rt.RemoteHost(); host != "" {
+		cfg.RemoteHost = host
+		if err := validateRemoteRun(cfg); err != nil {
 			return err
 		}
-		cfg.Image = customImage
+		if rt.Capabilities().PodSpec {
+			if err := validateKubernetesRun(cfg); err != nil {
+				return err
+			}
+		}
+		info("Using remote engine %s: host paths are copied into the container instead of mounted", host)
 	}
+	timer.mark("runtime")
 	warnSecurityRelaxations(cfg)
 
-	// Warn if Docker has low memory (can cause OOM with Claude)
-	checkDockerMemory(cfg.Runtime)
-
-	// Ensure Docker network exists before starting container
-	if cfg.Docker {
+	// These steps only read cfg, so they run concurrently and their results
+	// are applied afterwards.
+	var (
+		ociRuntime     string
+		imageCfg       = cfg
+		customImage    string
+		composeNetwork string
+	)
+	var tasks []preflightTask
+	if hasCustomization(cfg) {
+		// First, so a pull or build streams to the terminal as it runs.
+		tasks = append(tasks, preflightTask{"custom image", func(io.Writer) error {
+			var err error
+			customImage, err = prepareCustomImage(&imageCfg, rt, projectDir)
+			return err
+		}})
+	}
+	if strongIsolation(cfg) {
+		tasks = append(tasks, preflightTask{"isolation", func(io.Writer) error {
+			var err error
+			ociRuntime, err = isolationRuntime(rt, cfg.Isolation)
+			return err
+		}})
+	}
+	tasks = append(tasks, preflightTask{"memory", func(out io.Writer) error {
+		// Warn if Docker has low memory (can cause OOM with Claude)
+		checkDockerMemory(out, rt)
+		return nil
+	}})
+	tasks = append(tasks, preflightTask{"network", func(out io.Writer) error {
 		networkName := cfg.Network
-		if networkName == "" {
-			networkName = "yolobox-net"
+		if cfg.Compose {
+			project, err := findComposeProject(rt, projectDir)
+			if err != nil {
+				return err
+			}
+			composeNetwork = project.Network
+			networkName = project.Network
+			infoTo(out, "Joining compose network %s (project %s)", project.Network, project.Name)
+		}
+
+		// Ensure Docker network exists before starting container
+		if cfg.Docker && cfg.DryRun == "" {
+			if networkName == "" {
+				networkName = "yolobox-net"
+			}
+			return ensureDockerNetwork(rt, networkName)
+		}
+		return nil
+	}})
+	if err := timer.parallel("preflight", tasks); err != nil {
+		return err
+	}
+	if ociRuntime != "" {
+		cfg.OCIRuntime = ociRuntime
+	}
+	if customImage != "" {
+		cfg.Image = customImage
+		cfg.Customize.Dockerfile = imageCfg.Customize.Dockerfile
+	}
+	if composeNetwork != "" {
+		cfg.Network = composeNetwork
+	}
+
+	var sess *session
+	if cfg.DryRun != "" {
+		sess, err = dryRunSession(projectDir, command)
+		if err != nil {
+			return err
 		}
-		if err := ensureDockerNetwork(cfg.Runtime, networkName); err != nil {
+		defer func() {
+			_ = os.RemoveAll(sess.dir)
+		}()
+	} else {
+		sess, err = startSession(projectDir, command)
+		if err != nil {
+			return err
+		}
+	}
+	cfg.ContainerName = "yolobox-" + sess.ID
+	sess.Runtime = rt.Name()
+	sess.Container = cfg.ContainerName
+	if err := publishPorts(&cfg, sess); err != nil {
+		return err
+	}
+	timer.mark("session")
+
+	credSync, err := prepareCredentialSync(&cfg)
+	if err != nil {
+		return err
+	}
+	if credSync != nil {
+		defer credSync.cleanup()
+	}
+	gitCreds, err := startGitCredentialBridge(&cfg)
+	if err != nil {
+		return err
+	}
+	if gitCreds != nil {
+		defer gitCreds.close()
+	}
+	sshProxy, err := startSSHAgentProxy(&cfg)
+	if err != nil {
+		return err
+	}
+	if sshProxy != nil {
+		defer sshProxy.close()
+	}
+	apiProxy, err := startAPIKeyProxy(&cfg)
+	if err != nil {
+		return err
+	}
+	if apiProxy != nil {
+		defer apiProxy.close()
+	}
+	egress, err := startEgressProxy(&cfg, sess)
+	if err != nil {
+		return err
+	}
+	if egress != nil {
+		defer egress.close()
+	}
+	hostRelay, err := startHostServices(&cfg)
+	if err != nil {
+		return err
+	}
+	if hostRelay != nil {
+		defer hostRelay.close()
+	}
+	timer.mark("host bridges")
+	var serviceCalls [][]string
+	if cfg.DryRun != "" {
+		serviceCalls = serviceInvocations(&cfg, rt, sess)
+	} else {
+		services, err := startServices(&cfg, rt, sess)
+		if err != nil {
 			return err
 		}
+		if services != nil {
+			defer services.close()
+		}
 	}
+	timer.mark("services")
 
 	args, cleanupPaths, err := buildRunArgs(cfg, projectDir, command, interactive)
 	if err != nil {
@@ -664,7 +1056,46 @@ func runCommand(cfg Config, command []string, interactive bool) error {
 			_ = os.RemoveAll(p)
 		}
 	}()
-	return execRuntime(cfg.Runtime, args)
+	timer.mark("run args")
+	if cfg.Timings {
+		timer.print()
+	}
+	if cfg.DryRun != "" && rt.Capabilities().PodSpec {
+		kp, err := newKubernetesPod(cfg, args, command)
+		if err != nil {
+			return err
+		}
+		for _, m := range kp.mounts {
+			info("Would copy %s to %s on %s", m.src, m.dst, cfg.RemoteHost)
+		}
+		return printKubernetesDryRun(cfg.DryRun, kp)
+	}
+	if cfg.DryRun != "" {
+		if cfg.RemoteHost != "" {
+			createArgs, mounts := remoteCreateArgs(args)
+			for _, m := range mounts {
+				info("Would copy %s to %s on %s", m.src, m.dst, cfg.RemoteHost)
+			}
+			args = createArgs
+		}
+		return printDryRun(cfg.DryRun, rt.Name(), args, command, serviceCalls)
+	}
+	var runErr error
+	switch {
+	case rt.Capabilities().PodSpec:
+		runErr = runKubernetes(rt, cfg, projectDir, args, command)
+	case cfg.RemoteHost != "":
+		runErr = runRemote(rt, cfg, projectDir, args)
+	default:
+		runErr = rt.Run(args...)
+	}
+	if credSync != nil {
+		credSync.syncBack()
+	}
+	if egress != nil {
+		egress.reportDenied()
+	}
+	return runErr
 }
 
 func formatTomlStringSlice(values []string) string {
@@ -905,30 +1336,42 @@ func isToolShortcut(cmd string) bool {
 	return contains(toolShortcuts, cmd)
 }
 
+// yoloboxFlagNames are the flags parseBaseFlags accepts, so splitToolArgs
+// can tell them from the tool's own flags.
+var yoloboxFlagNames = map[string]bool{
+	"runtime": true, "isolation": true, "remote-sync": true, "image": true, "network": true, "pod": true,
+	"ssh-agent": true, "readonly-project": true, "no-network": true,
+	"no-yolo": true, "scratch": true, "claude-config": true,
+	"codex-config": true, "gemini-config": true, "git-config": true, "gh-token": true,
+	"sync-credentials-back": true, "git-credentials": true, "git-credential-allow": true,
+	"ssh-agent-key": true, "ssh-agent-confirm": true, "keyless": true,
+	"allow-domain": true, "network-log": true, "publish": true, "host-service": true,
+	"dns": true, "dns-search": true, "add-host": true, "compose": true,
+	"ca-certificate": true, "proxy-passthrough": true,
+	"copy-agent-instructions": true, "docker": true, "setup": true, "mount": true,
+	"exclude": true, "copy-as": true,
+	"env": true, "h": true, "help": true,
+	"cpus": true, "memory": true, "shm-size": true, "gpus": true,
+	"device": true, "cap-add": true, "cap-drop": true, "runtime-arg": true,
+	"packages": true, "customize-file": true, "rebuild-image": true, "dry-run": true,
+	"timings": true,
+}
+
+// yoloboxValueFlags are the flags that take a value.
+var yoloboxValueFlags = map[string]bool{
+	"runtime": true, "isolation": true, "remote-sync": true, "image": true, "network": true, "pod": true,
+	"mount": true, "exclude": true, "copy-as": true, "env": true, "cpus": true, "memory": true,
+	"shm-size": true, "device": true, "cap-add": true, "cap-drop": true,
+	"gpus": true, "runtime-arg": true, "packages": true, "customize-file": true,
+	"git-credential-allow": true, "ssh-agent-key": true, "allow-domain": true,
+	"publish": true, "host-service": true, "dns": true, "dns-search": true, "add-host": true,
+	"ca-certificate": true,
+}
+
 // splitToolArgs separates yolobox flags from tool flags for shortcuts.
 // This allows `yolobox claude --resume` to pass --resume to claude instead of
 // failing because --resume is not a known yolobox flag.
 func splitToolArgs(args []string) (yoloboxArgs, toolArgs []string) {
-	knownFlags := map[string]bool{
-		"runtime": true, "image": true, "network": true, "pod": true,
-		"ssh-agent": true, "readonly-project": true, "no-network": true,
-		"no-yolo": true, "scratch": true, "claude-config": true,
-		"codex-config": true, "gemini-config": true, "git-config": true, "gh-token": true,
-		"copy-agent-instructions": true, "docker": true, "setup": true, "mount": true,
-		"exclude": true, "copy-as": true,
-		"env": true, "h": true, "help": true,
-		"cpus": true, "memory": true, "shm-size": true, "gpus": true,
-		"device": true, "cap-add": true, "cap-drop": true, "runtime-arg": true,
-		"packages": true, "customize-file": true, "rebuild-image": true,
-	}
-
-	flagsWithValues := map[string]bool{
-		"runtime": true, "image": true, "network": true, "pod": true,
-		"mount": true, "exclude": true, "copy-as": true, "env": true, "cpus": true, "memory": true,
-		"shm-size": true, "device": true, "cap-add": true, "cap-drop": true,
-		"gpus": true, "runtime-arg": true, "packages": true, "customize-file": true,
-	}
-
 	i := 0
 	for i < len(args) {
 		arg := args[i]
@@ -951,7 +1394,7 @@ func splitToolArgs(args []string) (yoloboxArgs, toolArgs []string) {
 			hasValue = true
 		}
 
-		if !knownFlags[flagName] {
+		if !yoloboxFlagNames[flagName] {
 			// Unknown flag - this and rest go to tool
 			return yoloboxArgs, args[i:]
 		}
@@ -961,7 +1404,7 @@ func splitToolArgs(args []string) (yoloboxArgs, toolArgs []string) {
 		i++
 
 		// If it's a flag that takes a value and doesn't have =, consume next arg
-		if flagsWithValues[flagName] && !hasValue && i < len(args) && !strings.HasPrefix(args[i], "-") {
+		if yoloboxValueFlags[flagName] && !hasValue && i < len(args) && !strings.HasPrefix(args[i], "-") {
 			yoloboxArgs = append(yoloboxArgs, args[i])
 			i++
 		}
@@ -980,16 +1423,26 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 	// that should be removed after the container exits
 	var cleanupPaths []string
 
-	// Check if we're using Apple container (doesn't support file mounts)
-	appleContainer := isAppleContainer(cfg.Runtime)
-	if appleContainer && (len(cfg.Exclude) > 0 || len(cfg.CopyAs) > 0) {
-		return nil, nil, fmt.Errorf("--exclude and --copy-as are not supported with Apple container runtime")
+	rt := runtimeOrDocker(cfg.Runtime)
+	caps := rt.Capabilities()
+
+	// Apple container only mounts directories, so single files are staged
+	// in one directory instead
+	dirMountsOnly := !caps.FileMounts
+	if dirMountsOnly && (len(cfg.Exclude) > 0 || len(cfg.CopyAs) > 0) {
+		return nil, nil, fmt.Errorf("--exclude and --copy-as are not supported with %s runtime", rt.DisplayName())
 	}
 
-	// Check if we're using rootless Podman (needs --userns=keep-id for bind mount permissions)
-	rootlessPodman := isRootlessPodman(cfg.Runtime)
+	// Rootless Podman needs --userns=keep-id for bind mount permissions
+	rootlessPodman := caps.Rootless
 
 	args := []string{"run", "--rm"}
+	if cfg.ContainerName != "" {
+		args = append(args, "--name", cfg.ContainerName)
+	}
+	if cfg.OCIRuntime != "" {
+		args = append(args, "--runtime", cfg.OCIRuntime)
+	}
 
 	// Rootless Podman: map the host user to container UID 1000 (yolo) so
 	// bind-mounted files are accessible. Without this, the host user maps to
@@ -1037,11 +1490,38 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 
 	// Auto-passthrough common API keys
 	for _, key := range autoPassthroughEnvVars {
+		if !shouldPassthroughEnv(cfg, key) {
+			continue
+		}
 		if val := os.Getenv(key); val != "" {
 			args = append(args, "-e", key+"="+val)
 		}
 	}
 
+	// Corporate proxy settings from the host
+	if cfg.ProxyPassthrough {
+		for _, env := range proxyPassthroughEnv() {
+			args = append(args, "-e", env)
+		}
+	}
+
+	// Extra CA certificates, installed into the trust store by the entrypoint
+	if len(cfg.CACertificates) > 0 {
+		bundle, err := loadCACertificates(cfg.CACertificates, absProject)
+		if err != nil {
+			return nil, nil, err
+		}
+		caDir, err := prepareCACertificatesDir(bundle)
+		if err != nil {
+			return nil, nil, err
+		}
+		cleanupPaths = append(cleanupPaths, caDir)
+		args = append(args, "-v", caDir+":"+caCertsMountPath+":ro")
+		for _, env := range caCertificateEnv() {
+			args = append(args, "-e", env)
+		}
+	}
+
 	// Forward GitHub CLI token (extracted from keychain/credential store)
 	if cfg.GhToken {
 		if token := getGhToken(); token != "" {
@@ -1054,11 +1534,17 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 		args = append(args, "-e", env)
 	}
 
-	projectMountSource, overlayCleanupPaths, err := buildProjectFilterMounts(cfg, absProject)
-	if err != nil {
-		return nil, nil, err
+	// A remote engine gets a copy of the project, which leaves out excluded
+	// paths itself.
+	projectMountSource := absProject
+	if cfg.RemoteHost == "" {
+		source, overlayCleanupPaths, err := buildProjectFilterMounts(cfg, absProject)
+		if err != nil {
+			return nil, nil, err
+		}
+		projectMountSource = source
+		cleanupPaths = append(cleanupPaths, overlayCleanupPaths...)
 	}
-	cleanupPaths = append(cleanupPaths, overlayCleanupPaths...)
 
 	// Project mount at its real host path (for session continuity)
 	// A symlink /workspace -> real path is created by the entrypoint
@@ -1086,9 +1572,9 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 
 	// For Apple container, we need to collect files and mount via a temp directory
 	// (Apple container only supports directory mounts, not file mounts)
-	var appleContainerFiles map[string]string
-	if appleContainer {
-		appleContainerFiles = make(map[string]string)
+	var stagedFiles map[string]string
+	if dirMountsOnly {
+		stagedFiles = make(map[string]string)
 	}
 
 	// Mount Claude config from host to staging area (copied to /home/yolo by entrypoint)
@@ -1116,41 +1602,26 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 			// Preprocess to remove installMethod (host install method doesn't apply in container)
 			if processedPath := preprocessClaudeConfig(claudeConfigFile); processedPath != "" {
 				cleanupPaths = append(cleanupPaths, processedPath)
-				if appleContainer {
-					appleContainerFiles[processedPath] = "claude/.claude.json"
+				if dirMountsOnly {
+					stagedFiles[processedPath] = "claude/.claude.json"
 				} else {
 					args = append(args, "-v", processedPath+":/host-claude/.claude.json:ro")
 				}
 			}
 		}
-		// On macOS, extract OAuth credentials from Keychain and mount as .credentials.json
-		// Write to unique temp file in ~/.yolobox/tmp/ (unique per invocation to
-		// avoid conflicts when multiple yolobox instances run concurrently)
-		if creds := getClaudeCredentials(); creds != "" {
-			tmpDir := filepath.Join(home, ".yolobox", "tmp")
-			if err := os.MkdirAll(tmpDir, 0700); err == nil {
-				f, err := os.CreateTemp(tmpDir, "claude-credentials-*.json")
-				if err == nil {
-					if _, writeErr := f.Write([]byte(creds)); writeErr == nil {
-						if closeErr := f.Close(); closeErr == nil {
-							if chmodErr := os.Chmod(f.Name(), 0600); chmodErr == nil {
-								credsPath := f.Name()
-								cleanupPaths = append(cleanupPaths, credsPath)
-								if appleContainer {
-									appleContainerFiles[credsPath] = "claude/.credentials.json"
-								} else {
-									args = append(args, "-v", credsPath+":/host-claude/.credentials.json:ro")
-								}
-							} else {
-								_ = os.Remove(f.Name())
-							}
-						} else {
-							_ = os.Remove(f.Name())
-						}
-					} else {
-						_ = f.Close()
-						_ = os.Remove(f.Name())
-					}
+		// Extract OAuth credentials from the host credential store (macOS
+		// Keychain, Linux Secret Service or credentials file) and mount them
+		// as .credentials.json
+		if creds := getClaudeCredentials(); creds.data != "" {
+			credsPath, err := stageClaudeCredentials(home, creds.data)
+			if err != nil {
+				warn("Failed to stage Claude credentials: %s", err)
+			} else {
+				cleanupPaths = append(cleanupPaths, credsPath)
+				if dirMountsOnly {
+					stagedFiles[credsPath] = "claude/.credentials.json"
+				} else {
+					args = append(args, "-v", credsPath+":/host-claude/.credentials.json:ro")
 				}
 			}
 		}
@@ -1208,8 +1679,8 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 		}
 		gitConfigFile := filepath.Join(home, ".gitconfig")
 		if _, err := os.Stat(gitConfigFile); err == nil {
-			if appleContainer {
-				appleContainerFiles[gitConfigFile] = "git/.gitconfig"
+			if dirMountsOnly {
+				stagedFiles[gitConfigFile] = "git/.gitconfig"
 			} else {
 				args = append(args, "-v", gitConfigFile+":/host-git/.gitconfig:ro")
 			}
@@ -1226,8 +1697,8 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 		// Claude: ~/.claude/CLAUDE.md
 		claudeMd := filepath.Join(home, ".claude", "CLAUDE.md")
 		if _, err := os.Stat(claudeMd); err == nil {
-			if appleContainer {
-				appleContainerFiles[claudeMd] = "agent-instructions/claude/CLAUDE.md"
+			if dirMountsOnly {
+				stagedFiles[claudeMd] = "agent-instructions/claude/CLAUDE.md"
 			} else {
 				args = append(args, "-v", claudeMd+":/host-agent-instructions/claude/CLAUDE.md:ro")
 			}
@@ -1235,8 +1706,8 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 		// Gemini: ~/.gemini/GEMINI.md
 		geminiMd := filepath.Join(home, ".gemini", "GEMINI.md")
 		if _, err := os.Stat(geminiMd); err == nil {
-			if appleContainer {
-				appleContainerFiles[geminiMd] = "agent-instructions/gemini/GEMINI.md"
+			if dirMountsOnly {
+				stagedFiles[geminiMd] = "agent-instructions/gemini/GEMINI.md"
 			} else {
 				args = append(args, "-v", geminiMd+":/host-agent-instructions/gemini/GEMINI.md:ro")
 			}
@@ -1244,8 +1715,8 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 		// Codex: ~/.codex/AGENTS.md
 		codexMd := filepath.Join(home, ".codex", "AGENTS.md")
 		if _, err := os.Stat(codexMd); err == nil {
-			if appleContainer {
-				appleContainerFiles[codexMd] = "agent-instructions/codex/AGENTS.md"
+			if dirMountsOnly {
+				stagedFiles[codexMd] = "agent-instructions/codex/AGENTS.md"
 			} else {
 				args = append(args, "-v", codexMd+":/host-agent-instructions/codex/AGENTS.md:ro")
 			}
@@ -1268,8 +1739,8 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 	}
 
 	// For Apple container: create temp dir with collected files and mount it
-	if appleContainer && len(appleContainerFiles) > 0 {
-		tmpDir, err := prepareFileMountDir(appleContainerFiles)
+	if dirMountsOnly && len(stagedFiles) > 0 {
+		tmpDir, err := prepareFileMountDir(stagedFiles)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -1305,9 +1776,12 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 
 	// SSH agent forwarding
 	if cfg.SSHAgent {
-		if appleContainer {
+		if caps.SSHForwarding {
 			// Apple container uses --ssh flag instead of socket mounts
 			args = append(args, "--ssh")
+		} else if cfg.SSHAgentSocket != "" {
+			args = append(args, "-v", cfg.SSHAgentSocket+":/ssh-agent")
+			args = append(args, "-e", "SSH_AUTH_SOCK=/ssh-agent")
 		} else {
 			sock, err := findSSHAgentSocket()
 			if err != nil {
@@ -1337,13 +1811,31 @@ func buildRunArgs(cfg Config, projectDir string, command []string, interactive b
 	if cfg.Pod != "" {
 		args = append(args, "--pod", cfg.Pod)
 	} else {
-		if cfg.NoNetwork {
+		if cfg.NoNetwork || len(cfg.AllowDomains) > 0 {
+			// With allow_domains all egress goes through the proxy socket.
+			// network_log alone keeps the network and logs what uses the
+			// proxy.
 			args = append(args, "--network", "none")
 		} else if cfg.Network != "" {
 			args = append(args, "--network", cfg.Network)
 		}
 	}
 
+	// host.yolobox.internal points at the in-container end of the host
+	// service relays (Apple container resolves it in the entrypoint instead)
+	if len(cfg.HostServices) > 0 && caps.AddHost {
+		args = append(args, "--add-host", hostServicesHostname+":"+hostServicesLoopback)
+	}
+	args = append(args, dnsRunArgs(cfg, caps.AddHost)...)
+
+	for _, spec := range cfg.Ports {
+		m, err := parsePortSpec(spec)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(args, "-p", m.runtimeArg())
+	}
+
 	if len(cfg.RuntimeArgs) > 0 {
 		args = append(args, cfg.RuntimeArgs...)
 	}
@@ -1433,10 +1925,16 @@ func resolveRuntime(name string) (string, error) {
 		if path, err := exec.LookPath("container"); err == nil {
 			return path, nil
 		}
-		return "", fmt.Errorf("no container runtime found. Install docker, podman, or Apple container and try again")
+		if path, err := exec.LookPath("nerdctl"); err == nil {
+			return path, nil
+		}
+		return "", fmt.Errorf("no container runtime found. Install docker, podman, nerdctl, or Apple container and try again")
 	}
-	if name == "colima" {
+	switch name {
+	case "colima":
 		name = "docker"
+	case "kubernetes":
+		name = "kubectl"
 	}
 	path, err := exec.LookPath(name)
 	if err != nil {
@@ -1445,14 +1943,6 @@ func resolveRuntime(name string) (string, error) {
 	return path, nil
 }
 
-func execRuntime(runtime string, args []string) error {
-	runtimePath, err := resolveRuntime(runtime)
-	if err != nil {
-		return err
-	}
-	return execCommand(runtimePath, args)
-}
-
 // getGhToken extracts the GitHub CLI token from the host's credential store
 // Returns empty string if gh is not installed or not logged in
 func getGhToken() string {
@@ -1464,20 +1954,6 @@ func getGhToken() string {
 	return strings.TrimSpace(string(output))
 }
 
-// getClaudeCredentials extracts Claude Code OAuth credentials from macOS Keychain
-// Returns empty string on non-macOS or if not logged in
-func getClaudeCredentials() string {
-	if runtime.GOOS != "darwin" {
-		return ""
-	}
-	cmd := exec.Command("security", "find-generic-password", "-s", "Claude Code-credentials", "-w")
-	output, err := cmd.Output()
-	if err != nil {
-		return ""
-	}
-	return strings.TrimSpace(string(output))
-}
-
 // preprocessClaudeConfig reads ~/.claude.json, removes installMethod (which is
 // host-specific and causes issues in the container), and writes to a temp file.
 // Returns the temp file path, or empty string on error.
@@ -1553,33 +2029,30 @@ func detectTimezone() string {
 	return ""
 }
 
-// checkDockerMemory warns if Docker has less than 4GB RAM available
-func checkDockerMemory(runtime string) {
-	runtimePath, err := resolveRuntime(runtime)
-	if err != nil {
-		return
-	}
-
-	// Skip memory check for Apple container (uses native VM with dynamic memory)
-	if strings.HasSuffix(runtimePath, "/container") {
-		return
-	}
+// minRuntimeMemoryGB is the engine memory below which Claude Code tends to
+// be OOM killed.
+const minRuntimeMemoryGB = 3.5
 
-	cmd := exec.Command(runtimePath, "info", "--format", "{{.MemTotal}}")
-	output, err := cmd.Output()
-	if err != nil {
-		return
+// runtimeMemoryGB returns the engine's total memory. Only Docker and nerdctl
+// report a fixed VM memory size; Apple container uses a VM per container
+// with dynamic memory.
+func runtimeMemoryGB(rt Runtime) (float64, bool) {
+	if !rt.Capabilities().MemoryInfo {
+		return 0, false
 	}
-
-	memBytes, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	memBytes, err := rt.MemTotal()
 	if err != nil {
-		return
+		return 0, false
 	}
+	return float64(memBytes) / (1024 * 1024 * 1024), true
+}
 
-	memGB := float64(memBytes) / (1024 * 1024 * 1024)
-	if memGB < 3.5 {
-		warn("Docker has only %.1fGB RAM. Claude Code may get OOM killed.", memGB)
-		warn("Increase Docker/Colima memory to 4GB+ for best results.")
+// checkDockerMemory warns on out if Docker has less than 4GB RAM available
+func checkDockerMemory(out io.Writer, rt Runtime) {
+	memGB, ok := runtimeMemoryGB(rt)
+	if ok && memGB < minRuntimeMemoryGB {
+		warnTo(out, "%s has only %.1fGB RAM. Claude Code may get OOM killed.", rt.DisplayName(), memGB)
+		warnTo(out, "Increase its memory to 4GB+ for best results: %s", memoryFixHint(rt))
 	}
 }
 
@@ -1589,11 +2062,19 @@ func success(format string, args ...interface{}) {
 }
 
 func info(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, colorBlue+"→ "+colorReset+format+"\n", args...)
+	infoTo(os.Stderr, format, args...)
+}
+
+func infoTo(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, colorBlue+"→ "+colorReset+format+"\n", args...)
 }
 
 func warn(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, colorYellow+"⚠ "+colorReset+format+"\n", args...)
+	warnTo(os.Stderr, format, args...)
+}
+
+func warnTo(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, colorYellow+"⚠ "+colorReset+format+"\n", args...)
 }
 
 func errorf(format string, args ...interface{}) {
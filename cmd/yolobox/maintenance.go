@@ -33,15 +33,13 @@ func resetVolumes(args []string) error {
 	if err != nil {
 		return err
 	}
-	runtimePath, err := resolveRuntime(cfg.Runtime)
+	rt, err := loadRuntime(cfg.Runtime)
 	if err != nil {
 		return err
 	}
 
 	warn("Removing yolobox volumes...")
-	volumes := []string{"yolobox-home", "yolobox-cache"}
-	args = append([]string{"volume", "rm"}, volumes...)
-	if err := execCommand(runtimePath, args); err != nil {
+	if err := rt.RemoveVolumes(false, "yolobox-home", "yolobox-cache"); err != nil {
 		return err
 	}
 	success("Fresh start! All volumes removed.")
@@ -83,11 +81,10 @@ func uninstallYolobox(args []string) error {
 	if !*keepVolumes {
 		cfg, err := loadConfigFromEnv()
 		if err == nil {
-			runtimePath, err := resolveRuntime(cfg.Runtime)
+			rt, err := loadRuntime(cfg.Runtime)
 			if err == nil {
 				info("Removing Docker volumes...")
-				volumes := []string{"yolobox-home", "yolobox-cache", "yolobox-output"}
-				_ = execCommand(runtimePath, append([]string{"volume", "rm", "-f"}, volumes...))
+				_ = rt.RemoveVolumes(true, "yolobox-home", "yolobox-cache", "yolobox-output")
 			}
 		}
 	}
@@ -215,11 +212,11 @@ func upgradeYolobox() error {
 
 	info("Pulling latest Docker image...")
 	cfg := defaultConfig()
-	runtimePath, err := resolveRuntime(cfg.Runtime)
+	rt, err := loadRuntime(cfg.Runtime)
 	if err != nil {
 		return err
 	}
-	if err := execCommand(runtimePath, []string{"pull", cfg.Image}); err != nil {
+	if err := rt.Run("pull", cfg.Image); err != nil {
 		return fmt.Errorf("failed to pull image: %w", err)
 	}
 
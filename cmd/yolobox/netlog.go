@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const netlogFile = "netlog.jsonl"
+
+// netlogEntry is one outbound connection attempt recorded by the egress proxy.
+type netlogEntry struct {
+	Time          time.Time `json:"time"`
+	Host          string    `json:"host"`
+	Port          string    `json:"port"`
+	Remote        string    `json:"remote,omitempty"`
+	Method        string    `json:"method"`
+	Decision      string    `json:"decision"`
+	BytesSent     int64     `json:"bytes_sent"`
+	BytesReceived int64     `json:"bytes_received"`
+	DurationMs    int64     `json:"duration_ms"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// netlogWriter appends entries as JSON lines. It is safe for concurrent use.
+type netlogWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (n *netlogWriter) write(entry netlogEntry) {
+	if n == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, _ = n.w.Write(append(data, '\n'))
+}
+
+func (n *netlogWriter) close() {
+	if n == nil {
+		return
+	}
+	if closer, ok := n.w.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+func openNetlog(path string) (*netlogWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &netlogWriter{w: f}, nil
+}
+
+// netlogHostSummary aggregates log entries for one destination host.
+type netlogHostSummary struct {
+	Host          string
+	Connections   int
+	Denied        int
+	Errors        int
+	BytesSent     int64
+	BytesReceived int64
+}
+
+func readNetlog(r io.Reader) ([]netlogEntry, error) {
+	var entries []netlogEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry netlogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// summarizeNetlog groups entries by host, busiest first.
+func summarizeNetlog(entries []netlogEntry) []netlogHostSummary {
+	byHost := map[string]*netlogHostSummary{}
+	for _, e := range entries {
+		s, ok := byHost[e.Host]
+		if !ok {
+			s = &netlogHostSummary{Host: e.Host}
+			byHost[e.Host] = s
+		}
+		s.Connections++
+		switch e.Decision {
+		case "deny":
+			s.Denied++
+		case "error":
+			s.Errors++
+		}
+		s.BytesSent += e.BytesSent
+		s.BytesReceived += e.BytesReceived
+	}
+	summaries := make([]netlogHostSummary, 0, len(byHost))
+	for _, s := range byHost {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Connections != summaries[j].Connections {
+			return summaries[i].Connections > summaries[j].Connections
+		}
+		return summaries[i].Host < summaries[j].Host
+	})
+	return summaries
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// netlogCommand implements `yolobox netlog [session]`.
+func netlogCommand(args []string) error {
+	fs := flag.NewFlagSet("netlog", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage()
+			return errHelp
+		}
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: yolobox netlog [session]")
+	}
+
+	var sess *session
+	var err error
+	if fs.NArg() == 1 {
+		sess, err = loadSession(fs.Arg(0))
+	} else {
+		sess, err = loadLatestSession(func(s *session) bool {
+			_, err := os.Stat(s.path(netlogFile))
+			return err == nil
+		})
+		if err != nil {
+			err = fmt.Errorf("no yolobox sessions with a network log found (enable network_log = true)")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(sess.path(netlogFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("session %s has no network log (enable network_log = true)", sess.ID)
+		}
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	entries, err := readNetlog(f)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%ssession:%s %s (%s)\n", colorBold, colorReset, sess.ID, sess.Project)
+	fmt.Printf("%sconnections:%s %d\n", colorBold, colorReset, len(entries))
+	if len(entries) == 0 {
+		return nil
+	}
+	fmt.Println()
+	fmt.Printf("%-40s %6s %6s %6s %10s %10s\n", "HOST", "CONNS", "DENIED", "ERRORS", "SENT", "RECEIVED")
+	for _, s := range summarizeNetlog(entries) {
+		fmt.Printf("%-40s %6d %6d %6d %10s %10s\n", s.Host, s.Connections, s.Denied, s.Errors, formatBytes(s.BytesSent), formatBytes(s.BytesReceived))
+	}
+	fmt.Printf("\nFull log: %s\n", sess.path(netlogFile))
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// portMapping publishes a container port on a loopback host port.
+type portMapping struct {
+	Host      int    `json:"host"`
+	Container int    `json:"container"`
+	Protocol  string `json:"protocol"`
+}
+
+func (m portMapping) String() string {
+	return fmt.Sprintf("%d:%d/%s", m.Host, m.Container, m.Protocol)
+}
+
+func (m portMapping) hostKey() string {
+	return fmt.Sprintf("%d/%s", m.Host, m.Protocol)
+}
+
+// runtimeArg returns the -p value. Ports are bound to 127.0.0.1 so dev
+// servers are not exposed to the local network.
+func (m portMapping) runtimeArg() string {
+	arg := fmt.Sprintf("127.0.0.1:%d:%d", m.Host, m.Container)
+	if m.Protocol != "tcp" {
+		arg += "/" + m.Protocol
+	}
+	return arg
+}
+
+// parsePortSpec parses "[host:]container[/tcp|/udp]". Without a host port the
+// container port is published on the same host port.
+func parsePortSpec(spec string) (portMapping, error) {
+	m := portMapping{Protocol: "tcp"}
+	rest := strings.TrimSpace(spec)
+	if base, proto, ok := strings.Cut(rest, "/"); ok {
+		if proto != "tcp" && proto != "udp" {
+			return m, fmt.Errorf("invalid port %q: protocol must be tcp or udp", spec)
+		}
+		m.Protocol = proto
+		rest = base
+	}
+	hostPart, containerPart, hasHost := strings.Cut(rest, ":")
+	if !hasHost {
+		containerPart = hostPart
+	}
+	var err error
+	if m.Container, err = parsePortNumber(containerPart); err != nil {
+		return m, fmt.Errorf("invalid port %q: %w", spec, err)
+	}
+	m.Host = m.Container
+	if hasHost {
+		if m.Host, err = parsePortNumber(hostPart); err != nil {
+			return m, fmt.Errorf("invalid port %q: %w", spec, err)
+		}
+	}
+	return m, nil
+}
+
+func parsePortNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return 0, fmt.Errorf("%q is not a port number (1-65535)", s)
+	}
+	return n, nil
+}
+
+func validatePorts(cfg Config) error {
+	for _, spec := range cfg.Ports {
+		if _, err := parsePortSpec(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocatePorts resolves port specs, moving any mapping whose host port is
+// already taken to a free one so concurrent sessions do not collide.
+func allocatePorts(specs []string, free func(port int, proto string) bool, pick func(proto string) (int, error)) ([]portMapping, error) {
+	var mappings []portMapping
+	used := map[string]bool{}
+	for _, spec := range specs {
+		m, err := parsePortSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if used[m.hostKey()] || !free(m.Host, m.Protocol) {
+			requested := m.Host
+			if m.Host, err = pick(m.Protocol); err != nil {
+				return nil, fmt.Errorf("failed to find a free host port for %s: %w", spec, err)
+			}
+			warn("Host port %d is in use; publishing container port %d on %d instead", requested, m.Container, m.Host)
+		}
+		used[m.hostKey()] = true
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+func hostPortFree(port int, proto string) bool {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return false
+	}
+	_ = listener.Close()
+	return true
+}
+
+func pickFreeHostPort(proto string) (int, error) {
+	if proto == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+		return conn.LocalAddr().(*net.UDPAddr).Port, nil
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// publishPorts allocates host ports for cfg.Ports, rewrites them as explicit
+// host:container specs, records them in the session and prints their URLs.
+// A remote engine publishes them on its own machine, where yolobox cannot
+// tell which ports are free, so they are used as given.
+func publishPorts(cfg *Config, sess *session) error {
+	if len(cfg.Ports) == 0 {
+		return nil
+	}
+	free, host := hostPortFree, "localhost"
+	if cfg.RemoteHost != "" {
+		free = func(int, string) bool { return true }
+		if u, err := url.Parse(cfg.RemoteHost); err == nil && u.Hostname() != "" {
+			host = u.Hostname()
+		}
+	}
+	mappings, err := allocatePorts(cfg.Ports, free, pickFreeHostPort)
+	if err != nil {
+		return err
+	}
+	resolved := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		resolved = append(resolved, m.String())
+	}
+	cfg.Ports = resolved
+	sess.Ports = mappings
+	if err := sess.save(); err != nil {
+		return err
+	}
+	for _, m := range mappings {
+		if m.Protocol == "tcp" {
+			info("Port %d → http://%s:%d", m.Container, host, m.Host)
+		} else {
+			info("Port %d/%s → %s:%d", m.Container, m.Protocol, host, m.Host)
+		}
+	}
+	return nil
+}
+
+// portsCommand implements `yolobox ports [session]`.
+func portsCommand(args []string) error {
+	fs := flag.NewFlagSet("ports", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage()
+			return errHelp
+		}
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: yolobox ports [session]")
+	}
+
+	var sess *session
+	var err error
+	if fs.NArg() == 1 {
+		sess, err = loadSession(fs.Arg(0))
+	} else {
+		sess, err = loadLatestSession(func(s *session) bool { return len(s.Ports) > 0 })
+		if err != nil {
+			err = fmt.Errorf("no yolobox sessions with published ports found")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%ssession:%s %s (%s)\n", colorBold, colorReset, sess.ID, sess.Project)
+	ports, running := sessionPorts(sess)
+	if !running {
+		fmt.Printf("%sstatus:%s not running (ports it was started with)\n", colorBold, colorReset)
+	}
+	if len(ports) == 0 {
+		fmt.Println("No published ports")
+		return nil
+	}
+	fmt.Println()
+	fmt.Printf("%-16s %s\n", "CONTAINER", "HOST")
+	for _, m := range ports {
+		host := fmt.Sprintf("localhost:%d", m.Host)
+		if m.Protocol == "tcp" {
+			host = "http://" + host
+		}
+		fmt.Printf("%-16s %s\n", fmt.Sprintf("%d/%s", m.Container, m.Protocol), host)
+	}
+	return nil
+}
+
+// sessionPorts asks the engine for the session container's published ports.
+// When the container is not running, or the engine cannot say, it returns
+// the ports recorded at start and false.
+func sessionPorts(sess *session) ([]portMapping, bool) {
+	if sess.Container == "" || sess.Runtime == "" {
+		return sess.Ports, false
+	}
+	rt, err := loadRuntime(sess.Runtime)
+	if err != nil {
+		return sess.Ports, false
+	}
+	output, err := rt.Output("port", sess.Container)
+	if err != nil {
+		return sess.Ports, false
+	}
+	return parseRuntimePorts(string(output)), true
+}
+
+// parseRuntimePorts parses `port` output, one "3000/tcp -> 127.0.0.1:49001"
+// per line. A port bound on both IPv4 and IPv6 is listed once.
+func parseRuntimePorts(output string) []portMapping {
+	var ports []portMapping
+	seen := map[string]bool{}
+	for _, line := range strings.Split(output, "\n") {
+		containerPart, hostPart, ok := strings.Cut(strings.TrimSpace(line), " -> ")
+		if !ok {
+			continue
+		}
+		m, err := parsePortSpec(containerPart)
+		if err != nil {
+			continue
+		}
+		_, hostPort, err := net.SplitHostPort(hostPart)
+		if err != nil {
+			continue
+		}
+		if m.Host, err = parsePortNumber(hostPort); err != nil {
+			continue
+		}
+		if !seen[m.String()] {
+			seen[m.String()] = true
+			ports = append(ports, m)
+		}
+	}
+	return ports
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long preflight results are reused across runs. Runtime paths and
+// engine memory change rarely. A cached network is still inspected before
+// use, since `network prune` or an engine restart removes it.
+const (
+	runtimePathTTL = time.Hour
+	memTotalTTL    = 10 * time.Minute
+	networkTTL     = 10 * time.Minute
+)
+
+// processStart is when yolobox started, for --timings.
+var processStart = time.Now()
+
+// preflightCachePath is the cache of preflight results. Tests point it at a
+// temp dir.
+var preflightCachePath = func() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "yolobox", "preflight.json")
+}
+
+// preflightCacheMu serializes read-modify-write of the cache between the
+// concurrent preflight steps.
+var preflightCacheMu sync.Mutex
+
+type cachedRuntimePath struct {
+	Path      string    `json:"path"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// engineCache holds the results for one engine, keyed by runtime path and
+// the environment that selects its daemon.
+type engineCache struct {
+	MemTotal   int64                `json:"mem_total,omitempty"`
+	MemTotalAt time.Time            `json:"mem_total_at,omitempty"`
+	Networks   map[string]time.Time `json:"networks,omitempty"`
+}
+
+type preflightCache struct {
+	Runtimes map[string]cachedRuntimePath `json:"runtimes,omitempty"`
+	Engines  map[string]*engineCache      `json:"engines,omitempty"`
+}
+
+func readPreflightCache() preflightCache {
+	var cache preflightCache
+	path := preflightCachePath()
+	if path == "" {
+		return cache
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &cache)
+	}
+	return cache
+}
+
+// updatePreflightCache applies fn to the cache on disk. Failures are ignored:
+// the cache only saves time.
+func updatePreflightCache(fn func(*preflightCache)) {
+	path := preflightCachePath()
+	if path == "" {
+		return
+	}
+	preflightCacheMu.Lock()
+	defer preflightCacheMu.Unlock()
+
+	cache := readPreflightCache()
+	if cache.Runtimes == nil {
+		cache.Runtimes = map[string]cachedRuntimePath{}
+	}
+	if cache.Engines == nil {
+		cache.Engines = map[string]*engineCache{}
+	}
+	fn(&cache)
+	cache.prune(time.Now())
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	_ = writeFileAtomic(path, data, 0644)
+}
+
+// prune drops expired entries, so per-session network names do not pile up.
+func (c *preflightCache) prune(now time.Time) {
+	for name, entry := range c.Runtimes {
+		if now.Sub(entry.CheckedAt) >= runtimePathTTL {
+			delete(c.Runtimes, name)
+		}
+	}
+	for key, engine := range c.Engines {
+		for network, at := range engine.Networks {
+			if now.Sub(at) >= networkTTL {
+				delete(engine.Networks, network)
+			}
+		}
+		if now.Sub(engine.MemTotalAt) >= memTotalTTL {
+			engine.MemTotal = 0
+			engine.MemTotalAt = time.Time{}
+		}
+		if engine.MemTotal == 0 && len(engine.Networks) == 0 {
+			delete(c.Engines, key)
+		}
+	}
+}
+
+func (c *preflightCache) engine(key string) *engineCache {
+	engine := c.Engines[key]
+	if engine == nil {
+		engine = &engineCache{}
+		c.Engines[key] = engine
+	}
+	if engine.Networks == nil {
+		engine.Networks = map[string]time.Time{}
+	}
+	return engine
+}
+
+// cachedResolveRuntime is resolveRuntime, reusing the last answer for the
+// same PATH while the binary is still there.
+func cachedResolveRuntime(name string) (string, error) {
+	key := name + " PATH=" + os.Getenv("PATH")
+	entry, ok := readPreflightCache().Runtimes[key]
+	if ok && time.Since(entry.CheckedAt) < runtimePathTTL {
+		if _, err := os.Stat(entry.Path); err == nil {
+			return entry.Path, nil
+		}
+	}
+	path, err := resolveRuntime(name)
+	if err != nil {
+		return "", err
+	}
+	updatePreflightCache(func(c *preflightCache) {
+		c.Runtimes[key] = cachedRuntimePath{Path: path, CheckedAt: time.Now()}
+	})
+	return path, nil
+}
+
+// engineCacheKey identifies the daemon the runtime at path talks to. The
+// same CLI reaches a different engine through another docker context or
+// Podman connection.
+func engineCacheKey(path string) string {
+	key := []string{path}
+	if filepath.Base(path) == "docker" {
+		key = append(key, "host="+dockerHost())
+	}
+	for _, name := range []string{"CONTAINER_HOST", "CONTAINER_CONNECTION"} {
+		if value := os.Getenv(name); value != "" {
+			key = append(key, name+"="+value)
+		}
+	}
+	return strings.Join(key, " ")
+}
+
+// cachedRuntime remembers the engine's memory and the networks it has across
+// runs, so a warm start skips those queries.
+type cachedRuntime struct {
+	Runtime
+	key string
+}
+
+func (r cachedRuntime) MemTotal() (int64, error) {
+	if engine := readPreflightCache().Engines[r.key]; engine != nil && engine.MemTotal > 0 &&
+		time.Since(engine.MemTotalAt) < memTotalTTL {
+		return engine.MemTotal, nil
+	}
+	mem, err := r.Runtime.MemTotal()
+	if err != nil {
+		return 0, err
+	}
+	updatePreflightCache(func(c *preflightCache) {
+		engine := c.engine(r.key)
+		engine.MemTotal = mem
+		engine.MemTotalAt = time.Now()
+	})
+	return mem, nil
+}
+
+func (r cachedRuntime) CreateNetwork(name string) error {
+	if engine := readPreflightCache().Engines[r.key]; engine != nil {
+		if at, ok := engine.Networks[name]; ok && time.Since(at) < networkTTL {
+			if _, err := r.Runtime.Output("network", "inspect", name); err == nil {
+				return nil
+			}
+			updatePreflightCache(func(c *preflightCache) {
+				delete(c.engine(r.key).Networks, name)
+			})
+		}
+	}
+	if err := r.Runtime.CreateNetwork(name); err != nil {
+		return err
+	}
+	updatePreflightCache(func(c *preflightCache) {
+		c.engine(r.key).Networks[name] = time.Now()
+	})
+	return nil
+}
+
+// preflightTask is a startup step that does not depend on the others. It
+// writes its messages to out.
+type preflightTask struct {
+	name string
+	run  func(out io.Writer) error
+}
+
+type startupStep struct {
+	name     string
+	duration time.Duration
+	// nested marks a task that ran concurrently inside the step before it.
+	nested bool
+}
+
+// startupTimer records how long each startup step took, for --timings.
+type startupTimer struct {
+	last  time.Time
+	steps []startupStep
+}
+
+func newStartupTimer() *startupTimer {
+	return &startupTimer{last: processStart}
+}
+
+// mark records the time since the previous mark as step name.
+func (t *startupTimer) mark(name string) {
+	now := time.Now()
+	t.steps = append(t.steps, startupStep{name: name, duration: now.Sub(t.last)})
+	t.last = now
+}
+
+// parallel runs tasks concurrently and records them under step name. The
+// first task writes straight to stderr, so it can stream engine output; the
+// others are buffered and printed in task order once all are done. It
+// returns the first error in task order, so failures read the same as when
+// the steps ran one after another.
+func (t *startupTimer) parallel(name string, tasks []preflightTask) error {
+	errs := make([]error, len(tasks))
+	durations := make([]time.Duration, len(tasks))
+	outs := make([]bytes.Buffer, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		var out io.Writer = &outs[i]
+		if i == 0 {
+			out = os.Stderr
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = task.run(out)
+			durations[i] = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	for i := range outs {
+		_, _ = outs[i].WriteTo(os.Stderr)
+	}
+
+	t.mark(name)
+	for i, task := range tasks {
+		t.steps = append(t.steps, startupStep{name: task.name, duration: durations[i], nested: true})
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// print writes the recorded steps and the total to stderr.
+func (t *startupTimer) print() {
+	info("Startup timings:")
+	for _, step := range t.steps {
+		name := step.name
+		if step.nested {
+			name = "  " + name
+		}
+		fmt.Fprintf(os.Stderr, "    %-16s %s\n", name, formatStepDuration(step.duration))
+	}
+	fmt.Fprintf(os.Stderr, "    %-16s %s\n", "total", formatStepDuration(t.last.Sub(processStart)))
+}
+
+func formatStepDuration(d time.Duration) string {
+	return fmt.Sprintf("%7.1fms", float64(d.Microseconds())/1000)
+}
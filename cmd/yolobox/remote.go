@@ -0,0 +1,535 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// remoteSyncModes are the accepted values of remote_sync. exit copies the
+// project in at start and back on exit; live also pushes host edits while
+// the container runs.
+var remoteSyncModes = []string{"exit", "live"}
+
+// remoteSyncInterval is how often live sync looks for host edits.
+const remoteSyncInterval = 2 * time.Second
+
+func validateRemoteSync(cfg Config) error {
+	if cfg.RemoteSync == "" {
+		return nil
+	}
+	for _, mode := range remoteSyncModes {
+		if cfg.RemoteSync == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid remote_sync %q: use %s", cfg.RemoteSync, strings.Join(remoteSyncModes, " or "))
+}
+
+// validateRemoteRun rejects options that need the container to reach the
+// host: sockets cannot be copied to another machine.
+func validateRemoteRun(cfg Config) error {
+	var feature string
+	switch {
+	case cfg.Docker:
+		feature = "--docker"
+	case cfg.SSHAgent:
+		feature = "--ssh-agent"
+	case cfg.Keyless:
+		feature = "--keyless"
+	case cfg.GitCredentials.Enabled:
+		feature = "--git-credentials"
+	case egressProxied(cfg):
+		feature = "allow_domains and network_log"
+	case len(cfg.HostServices) > 0:
+		feature = "host_services"
+	case len(cfg.CopyAs) > 0:
+		feature = "--copy-as"
+	}
+	if feature != "" {
+		return fmt.Errorf("cannot use %s with the remote engine at %s: it needs a host socket or bind mount", feature, cfg.RemoteHost)
+	}
+	return nil
+}
+
+// remoteEngineHost returns host when it names another machine, or "" for a
+// local socket or a loopback address.
+func remoteEngineHost(host string) string {
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme == "" || u.Scheme == "unix" || u.Scheme == "npipe" {
+		return ""
+	}
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return ""
+	}
+	return host
+}
+
+// remoteMount is a bind mount replaced by copies for a remote engine.
+type remoteMount struct {
+	src      string
+	dst      string
+	readonly bool
+	// skip reports project paths that are not copied either way.
+	skip func(rel string) bool
+	// pushed records the mtime of each file copied in, by slash-separated
+	// path relative to src, to tell what the container changed or deleted.
+	pushed map[string]time.Time
+}
+
+func (m *remoteMount) skips(rel string) bool {
+	return m.skip != nil && m.skip(rel)
+}
+
+// remoteCreateArgs turns run args, as built by buildRunArgs, into create
+// args without host bind mounts, and returns those mounts. Named and
+// anonymous volumes stay, since they live on the remote engine.
+func remoteCreateArgs(args []string) ([]string, []*remoteMount) {
+	var createArgs []string
+	var mounts []*remoteMount
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case i == 0 && arg == "run":
+			createArgs = append(createArgs, "create")
+			continue
+		case arg == "--rm":
+			continue
+		case arg == "-v" && i+1 < len(args):
+			parts := strings.SplitN(args[i+1], ":", 3)
+			if len(parts) >= 2 && filepath.IsAbs(parts[0]) {
+				mount := &remoteMount{src: parts[0], dst: parts[1]}
+				if len(parts) == 3 {
+					for _, opt := range strings.Split(parts[2], ",") {
+						if opt == "ro" {
+							mount.readonly = true
+						}
+					}
+				}
+				mounts = append(mounts, mount)
+				i++
+				continue
+			}
+		}
+		createArgs = append(createArgs, arg)
+	}
+	return createArgs, mounts
+}
+
+// excludedPathSkip returns a skip func for the project paths matched by
+// exclude patterns, including ones the container creates.
+func excludedPathSkip(patterns []string) (func(string) bool, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	normalized := make([]string, 0, len(patterns))
+	for _, raw := range patterns {
+		pattern, err := normalizeProjectPattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, pattern)
+	}
+	return func(rel string) bool {
+		for p := rel; p != "." && p != ""; p = path.Dir(p) {
+			for _, pattern := range normalized {
+				if matchProjectPattern(pattern, p) {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+// runRemote runs args on a remote engine. The container is created without
+// host bind mounts, their contents are copied in, and writable ones are
+// copied back after it exits.
+func runRemote(rt Runtime, cfg Config, projectDir string, args []string) error {
+	absProject, err := filepath.Abs(projectDir)
+	if err != nil {
+		return err
+	}
+	createArgs, mounts := remoteCreateArgs(args)
+	project, err := remoteProject(cfg, absProject, mounts)
+	if err != nil {
+		return err
+	}
+
+	// Signals are caught so the changes are always copied back and the
+	// container removed: without a terminal, Ctrl-C reaches yolobox as well
+	// as the engine, and SIGTERM only reaches yolobox. Either one stops the
+	// container, which ends the attach below.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	output, err := rt.CombinedOutput(createArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to create container on %s: %s", cfg.RemoteHost, strings.TrimSpace(string(output)))
+	}
+	// Image pull progress may come first; the ID is the last line.
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	container := strings.TrimSpace(lines[len(lines)-1])
+	defer func() {
+		_, _ = rt.CombinedOutput("rm", "-f", container)
+	}()
+	var interrupted atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-signals:
+			interrupted.Store(true)
+			_, _ = rt.CombinedOutput("stop", container)
+		case <-done:
+		}
+	}()
+
+	roots := make([]string, len(mounts))
+	for i, m := range mounts {
+		roots[i] = remoteArchiveRoot(m)
+	}
+	info("Copying %s to %s", absProject, cfg.RemoteHost)
+	if err := pushRemoteMounts(rt, container, "/", mounts, roots); err != nil {
+		return fmt.Errorf("failed to copy files to %s: %w", cfg.RemoteHost, err)
+	}
+	if interrupted.Load() {
+		return fmt.Errorf("interrupted while copying files to %s", cfg.RemoteHost)
+	}
+
+	var stopSync func()
+	if cfg.RemoteSync == "live" && project != nil && !project.readonly {
+		stopSync = startLiveSync(rt, container, project)
+	}
+
+	startArgs := []string{"start", "-a"}
+	for _, arg := range createArgs {
+		if arg == "-it" || arg == "-i" {
+			startArgs = append(startArgs, "-i")
+			break
+		}
+	}
+	runErr := rt.Run(append(startArgs, container)...)
+	if stopSync != nil {
+		stopSync()
+	}
+
+	pullRemoteMounts(rt, container, cfg.RemoteHost, mounts)
+	return runErr
+}
+
+// remoteProject returns the mount of the project among mounts, set to skip
+// excluded paths, or nil when the project is not mounted.
+func remoteProject(cfg Config, absProject string, mounts []*remoteMount) (*remoteMount, error) {
+	for _, m := range mounts {
+		if m.src == absProject && m.dst == absProject {
+			skip, err := excludedPathSkip(cfg.Exclude)
+			if err != nil {
+				return nil, err
+			}
+			m.skip = skip
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// pullRemoteMounts copies the writable mounts back out of the container,
+// warning about the ones that fail.
+func pullRemoteMounts(rt Runtime, container, host string, mounts []*remoteMount) {
+	var writable []*remoteMount
+	for _, m := range mounts {
+		if !m.readonly {
+			writable = append(writable, m)
+		}
+	}
+	if len(writable) > 0 {
+		info("Copying changes back from %s", host)
+	}
+	for _, m := range writable {
+		if err := pullRemoteMount(rt, container, m); err != nil {
+			warn("Failed to copy %s back from %s: %s", m.dst, host, err)
+		}
+	}
+}
+
+// pushRemoteMounts copies the mounts into the container in one archive
+// extracted at dir, with mount i under roots[i].
+func pushRemoteMounts(rt Runtime, container, dir string, mounts []*remoteMount, roots []string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		for i, m := range mounts {
+			if _, err := writeRemoteMount(tw, m, roots[i], nil); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		_ = pw.CloseWithError(tw.Close())
+	}()
+	err := rt.CopyTo(container, dir, pr)
+	// Unblock the writer if the copy failed early.
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	return err
+}
+
+// remoteArchiveRoot is where m goes in an archive extracted at /.
+func remoteArchiveRoot(m *remoteMount) string {
+	return strings.TrimPrefix(m.dst, "/")
+}
+
+// writeRemoteMount adds m.src to tw under root, recording each file in
+// m.pushed, and returns the number of files written. Sockets and devices are
+// skipped. With changed set, only the regular files it accepts are written.
+func writeRemoteMount(tw *tar.Writer, m *remoteMount, root string, changed func(m *remoteMount, rel string, modTime time.Time) bool) (int, error) {
+	if m.pushed == nil {
+		m.pushed = map[string]time.Time{}
+	}
+	files := 0
+	err := filepath.WalkDir(m.src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(m.src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if rel != "" && m.skips(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() && !fi.IsDir() && fi.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		if changed != nil && (!fi.Mode().IsRegular() || !changed(m, rel, fi.ModTime())) {
+			return nil
+		}
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(root, rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, f)
+			_ = f.Close()
+			if err != nil {
+				return err
+			}
+			m.pushed[rel] = fi.ModTime()
+			files++
+		}
+		return nil
+	})
+	return files, err
+}
+
+// startLiveSync pushes host edits to the project into the running container
+// until the returned func is called. Deletions on the host are not synced.
+func startLiveSync(rt Runtime, container string, project *remoteMount) func() {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(remoteSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				var buf bytes.Buffer
+				tw := tar.NewWriter(&buf)
+				files, err := writeRemoteMount(tw, project, remoteArchiveRoot(project), hostFileChanged)
+				if err == nil && tw.Close() == nil && files > 0 {
+					_ = rt.CopyTo(container, "/", &buf)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+	}
+}
+
+func hostFileChanged(m *remoteMount, rel string, modTime time.Time) bool {
+	pushed, ok := m.pushed[rel]
+	return !ok || !pushed.Equal(modTime)
+}
+
+// pullRemoteMount copies m.dst back out of the container into m.src.
+// Files the container left untouched are not rewritten, files it deleted
+// are removed, and a file changed on both sides keeps the host copy and
+// saves the container's next to it as <name>.remote.
+func pullRemoteMount(rt Runtime, container string, m *remoteMount) error {
+	pr, pw := io.Pipe()
+	seen := map[string]bool{}
+	done := make(chan error, 1)
+	go func() {
+		err := extractRemoteMount(tar.NewReader(pr), m, seen)
+		// Drain so the copy command is not blocked on a full pipe.
+		_, _ = io.Copy(io.Discard, pr)
+		done <- err
+	}()
+	copyErr := rt.CopyFrom(container, m.dst, pw)
+	_ = pw.CloseWithError(copyErr)
+	if err := <-done; err != nil {
+		return err
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+
+	for rel, pushedAt := range m.pushed {
+		if seen[rel] {
+			continue
+		}
+		hostPath := filepath.Join(m.src, filepath.FromSlash(rel))
+		if fi, err := os.Lstat(hostPath); err == nil && fi.ModTime().Equal(pushedAt) {
+			_ = os.Remove(hostPath)
+		}
+	}
+	return nil
+}
+
+func extractRemoteMount(tr *tar.Reader, m *remoteMount, seen map[string]bool) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Entries are rooted at the base name of m.dst.
+		rel := ""
+		if _, rest, ok := strings.Cut(strings.TrimSuffix(hdr.Name, "/"), "/"); ok {
+			rel = rest
+		}
+		if rel != "" && (!filepath.IsLocal(filepath.FromSlash(rel)) || m.skips(rel)) {
+			continue
+		}
+		target := m.src
+		if rel != "" {
+			target = filepath.Join(m.src, filepath.FromSlash(rel))
+			// The container is not trusted: never write through a
+			// symlink it planted in a parent directory.
+			if !parentsInsideRoot(m.src, rel) {
+				continue
+			}
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			seen[rel] = true
+		}
+		if err := extractRemoteEntry(tr, hdr, m, rel, target); err != nil {
+			return err
+		}
+	}
+}
+
+func extractRemoteEntry(tr *tar.Reader, hdr *tar.Header, m *remoteMount, rel, target string) error {
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, 0755)
+	case tar.TypeSymlink:
+		if current, err := os.Readlink(target); err == nil && current == hdr.Linkname {
+			return nil
+		}
+		_ = os.Remove(target)
+		return os.Symlink(hdr.Linkname, target)
+	case tar.TypeReg:
+	default:
+		return nil
+	}
+
+	pushedAt, wasPushed := m.pushed[rel]
+	if wasPushed && hdr.ModTime.Unix() == pushedAt.Unix() {
+		// Unchanged in the container; keep the host copy, which may have
+		// been edited since.
+		return nil
+	}
+	if fi, err := os.Lstat(target); err == nil {
+		if fi.Mode()&os.ModeSymlink != 0 || fi.IsDir() {
+			return nil
+		}
+		if wasPushed && !fi.ModTime().Equal(pushedAt) {
+			warn("%s changed on both sides; keeping the host copy and saving the container's as %s.remote", target, filepath.Base(target))
+			target += ".remote"
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, tr); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
+
+// parentsInsideRoot reports whether no parent directory of rel under root
+// is a symlink.
+func parentsInsideRoot(root, rel string) bool {
+	dir := root
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		fi, err := os.Lstat(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return true
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink != 0 {
+			return false
+		}
+	}
+	return true
+}
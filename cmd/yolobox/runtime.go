@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Runtime is a container engine yolobox drives through its CLI. Code that
+// behaves differently per engine should ask for a capability rather than
+// check the engine's name.
+type Runtime interface {
+	// Name is the engine's command name: docker, podman, nerdctl or
+	// container, or kubernetes for kubectl.
+	Name() string
+	// DisplayName names the engine in messages, e.g. "Apple container".
+	DisplayName() string
+	Capabilities() RuntimeCapabilities
+
+	// Run runs the engine attached to the terminal.
+	Run(args ...string) error
+	// Output runs the engine and returns its stdout.
+	Output(args ...string) ([]byte, error)
+	// CombinedOutput runs the engine and returns its stdout and stderr.
+	CombinedOutput(args ...string) ([]byte, error)
+	// Build builds dockerfile into tag, attached to the terminal.
+	Build(tag, dockerfile, contextDir string, extraArgs []string) error
+	// ImageID returns the ID of a local image.
+	ImageID(image string) (string, error)
+	// RemoveVolumes removes named volumes. With force, volumes that do
+	// not exist are not an error.
+	RemoveVolumes(force bool, names ...string) error
+	// OCIRuntimes lists the OCI runtimes `run --runtime` accepts.
+	OCIRuntimes() ([]string, error)
+	// Ping checks that the engine's daemon or system service is reachable.
+	Ping() error
+	// MemTotal returns the engine's total memory in bytes, when
+	// Capabilities().MemoryInfo is set.
+	MemTotal() (int64, error)
+	// CreateNetwork creates a network. An existing network is not an error.
+	CreateNetwork(name string) error
+	// RemoteHost returns the engine's host when it runs on another
+	// machine, where host paths cannot be bind-mounted, or "".
+	RemoteHost() string
+	// CopyTo extracts a tar archive into a container at dir.
+	CopyTo(container, dir string, archive io.Reader) error
+	// CopyFrom writes a tar archive of path in a container to w. Entries
+	// are rooted at path's base name.
+	CopyFrom(container, path string, w io.Writer) error
+}
+
+// RuntimeCapabilities lists the engine features yolobox relies on.
+type RuntimeCapabilities struct {
+	// FileMounts means single files and Unix sockets can be bind-mounted,
+	// not just directories.
+	FileMounts bool
+	// Pods means --pod can join an existing pod.
+	Pods bool
+	// Build means custom images can be built.
+	Build bool
+	// Rootless means the host user is root inside a user namespace, so
+	// bind mounts need --userns=keep-id to be writable by the yolo user.
+	Rootless bool
+	// Labels means containers take --label and ps can filter by label.
+	Labels bool
+	// Networks means user-defined networks where containers resolve each
+	// other by name.
+	Networks bool
+	// NetworkAliases means --network-alias; without it a container is
+	// found by its --hostname.
+	NetworkAliases bool
+	// AddHost means /etc/hosts entries can be added with --add-host.
+	AddHost bool
+	// SSHForwarding means --ssh forwards the host's SSH agent, instead of
+	// mounting its socket.
+	SSHForwarding bool
+	// MemoryInfo means `info` reports the engine's total memory as
+	// .MemTotal.
+	MemoryInfo bool
+	// PodSpec means the sandbox runs as a Kubernetes pod translated from
+	// the run args, instead of through `run`.
+	PodSpec bool
+}
+
+// loadRuntime resolves the configured runtime. Tests swap in a fake.
+var loadRuntime = detectRuntime
+
+// detectedRuntimes holds the runtimes resolved so far by name, so the
+// engine API ping runs once per process.
+var detectedRuntimes sync.Map
+
+func detectRuntime(name string) (Runtime, error) {
+	if rt, ok := detectedRuntimes.Load(name); ok {
+		return rt.(Runtime), nil
+	}
+	path, err := cachedResolveRuntime(name)
+	if err != nil {
+		return nil, err
+	}
+	rt := Runtime(cachedRuntime{Runtime: runtimeForPath(path), key: engineCacheKey(path)})
+	detectedRuntimes.Store(name, rt)
+	return rt, nil
+}
+
+func runtimeForPath(path string) Runtime {
+	cli := cliRuntime{path: path}
+	switch filepath.Base(path) {
+	case "podman":
+		rootless := currentUID() != 0
+		return withEngineAPI(podmanRuntime{cliRuntime: cli, rootless: rootless}, podmanAPISocket(rootless))
+	case "nerdctl":
+		return nerdctlRuntime{cliRuntime: cli}
+	case "container":
+		return appleContainerRuntime{cliRuntime: cli}
+	case "kubectl":
+		return kubernetesRuntime{cliRuntime: cli}
+	default:
+		return withEngineAPI(dockerRuntime{cliRuntime: cli}, dockerAPISocket())
+	}
+}
+
+// runtimeOrDocker returns the configured runtime, or Docker when none can be
+// resolved, so run args can still be built without an engine installed.
+func runtimeOrDocker(name string) Runtime {
+	rt, err := loadRuntime(name)
+	if err != nil {
+		return dockerRuntime{cliRuntime: cliRuntime{path: "docker"}}
+	}
+	return rt
+}
+
+// cliRuntime runs the engine binary at path.
+type cliRuntime struct {
+	path string
+}
+
+func (r cliRuntime) Run(args ...string) error {
+	return execCommand(r.path, args)
+}
+
+func (r cliRuntime) Output(args ...string) ([]byte, error) {
+	return exec.Command(r.path, args...).Output()
+}
+
+func (r cliRuntime) CombinedOutput(args ...string) ([]byte, error) {
+	return exec.Command(r.path, args...).CombinedOutput()
+}
+
+func (r cliRuntime) Ping() error {
+	return r.ping("ps", "-q")
+}
+
+func (r cliRuntime) ping(args ...string) error {
+	if output, err := r.CombinedOutput(args...); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r cliRuntime) MemTotal() (int64, error) {
+	output, err := r.Output("info", "--format", "{{.MemTotal}}")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+}
+
+func (r cliRuntime) CreateNetwork(name string) error {
+	output, err := r.CombinedOutput("network", "create", name)
+	if err != nil {
+		// docker, podman and nerdctl all say "already exists".
+		if strings.Contains(string(output), "already exists") {
+			return nil
+		}
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (cliRuntime) RemoteHost() string {
+	return ""
+}
+
+func (r cliRuntime) CopyTo(container, dir string, archive io.Reader) error {
+	return r.copyIn(archive, "cp", "-a", "-", container+":"+dir)
+}
+
+func (r cliRuntime) CopyFrom(container, path string, w io.Writer) error {
+	return r.copyOut(w, "cp", container+":"+path, "-")
+}
+
+// copyIn runs the engine with archive as its stdin.
+func (r cliRuntime) copyIn(archive io.Reader, args ...string) error {
+	cmd := exec.Command(r.path, args...)
+	cmd.Stdin = archive
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyOut runs the engine with its stdout going to w.
+func (r cliRuntime) copyOut(w io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(r.path, args...)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r cliRuntime) ImageID(image string) (string, error) {
+	return r.imageID(image, "{{.Id}}")
+}
+
+func (r cliRuntime) imageID(image, format string) (string, error) {
+	output, err := r.Output("image", "inspect", image, "--format", format)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (r cliRuntime) RemoveVolumes(force bool, names ...string) error {
+	args := []string{"volume", "rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	return r.Run(append(args, names...)...)
+}
+
+func (r cliRuntime) build(env []string, tag, dockerfile, contextDir string, extraArgs []string) error {
+	args := append([]string{"build", "-t", tag, "-f", dockerfile}, extraArgs...)
+	cmd := exec.Command(r.path, append(args, contextDir)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+type dockerRuntime struct {
+	cliRuntime
+}
+
+func (dockerRuntime) Name() string        { return "docker" }
+func (dockerRuntime) DisplayName() string { return "Docker" }
+
+func (dockerRuntime) Capabilities() RuntimeCapabilities {
+	return RuntimeCapabilities{
+		FileMounts:     true,
+		Build:          true,
+		Labels:         true,
+		Networks:       true,
+		NetworkAliases: true,
+		AddHost:        true,
+		MemoryInfo:     true,
+	}
+}
+
+func (r dockerRuntime) Build(tag, dockerfile, contextDir string, extraArgs []string) error {
+	// The generated Dockerfiles use RUN --mount cache mounts.
+	return r.build([]string{"DOCKER_BUILDKIT=1"}, tag, dockerfile, contextDir, extraArgs)
+}
+
+// RemoteHost reads DOCKER_HOST, then the endpoint of the active context.
+func (dockerRuntime) RemoteHost() string {
+	return remoteEngineHost(dockerHost())
+}
+
+func (r dockerRuntime) OCIRuntimes() ([]string, error) {
+	output, err := r.Output("info", "--format", "{{json .Runtimes}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Docker runtimes: %w", err)
+	}
+	return parseDockerRuntimes(output)
+}
+
+type podmanRuntime struct {
+	cliRuntime
+	rootless bool
+}
+
+func (podmanRuntime) Name() string        { return "podman" }
+func (podmanRuntime) DisplayName() string { return "Podman" }
+
+func (r podmanRuntime) Capabilities() RuntimeCapabilities {
+	return RuntimeCapabilities{
+		FileMounts:     true,
+		Pods:           true,
+		Build:          true,
+		Rootless:       r.rootless,
+		Labels:         true,
+		Networks:       true,
+		NetworkAliases: true,
+		AddHost:        true,
+	}
+}
+
+func (r podmanRuntime) Build(tag, dockerfile, contextDir string, extraArgs []string) error {
+	return r.build(nil, tag, dockerfile, contextDir, extraArgs)
+}
+
+// RemoteHost reads CONTAINER_HOST. A Podman machine is reached over SSH on
+// localhost and mounts the host's home directory, so it counts as local.
+func (podmanRuntime) RemoteHost() string {
+	return remoteEngineHost(os.Getenv("CONTAINER_HOST"))
+}
+
+// OCIRuntimes looks for the binaries because podman info only reports the
+// default runtime. containers.conf knows both by these names and searches
+// the usual install paths.
+func (podmanRuntime) OCIRuntimes() ([]string, error) {
+	return installedOCIRuntimes(map[string]string{
+		"runsc":        "runsc",
+		"kata-runtime": "kata",
+	}), nil
+}
+
+// nerdctlRuntime is containerd's Docker-compatible CLI, used by Rancher
+// Desktop and plain containerd installs. It builds through BuildKit and has
+// no pods or network aliases.
+type nerdctlRuntime struct {
+	cliRuntime
+}
+
+func (nerdctlRuntime) Name() string        { return "nerdctl" }
+func (nerdctlRuntime) DisplayName() string { return "nerdctl" }
+
+func (nerdctlRuntime) Capabilities() RuntimeCapabilities {
+	return RuntimeCapabilities{
+		FileMounts: true,
+		Build:      true,
+		Labels:     true,
+		Networks:   true,
+		AddHost:    true,
+		MemoryInfo: true,
+	}
+}
+
+func (r nerdctlRuntime) Build(tag, dockerfile, contextDir string, extraArgs []string) error {
+	return r.build(nil, tag, dockerfile, contextDir, extraArgs)
+}
+
+// ImageID uses the Go field name: nerdctl renders its Docker-compatible
+// inspect output from a struct whose ID field is not named Id.
+func (r nerdctlRuntime) ImageID(image string) (string, error) {
+	return r.imageID(image, "{{.ID}}")
+}
+
+// OCIRuntimes looks for the containerd shims; nerdctl takes the shim's
+// runtime type as --runtime.
+func (nerdctlRuntime) OCIRuntimes() ([]string, error) {
+	return installedOCIRuntimes(map[string]string{
+		"containerd-shim-runsc-v1": "io.containerd.runsc.v1",
+		"containerd-shim-kata-v2":  "io.containerd.kata.v2",
+	}), nil
+}
+
+// RemoveVolumes removes volumes one at a time. nerdctl has no force flag for
+// volume rm and fails the whole command when any volume is missing.
+func (r nerdctlRuntime) RemoveVolumes(force bool, names ...string) error {
+	for _, name := range names {
+		output, err := r.CombinedOutput("volume", "rm", name)
+		if err != nil && !(force && strings.Contains(string(output), "not found")) {
+			return fmt.Errorf("failed to remove volume %s: %s", name, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// appleContainerRuntime is Apple's container tool. Each container runs in its
+// own lightweight VM, which limits mounts to directories.
+type appleContainerRuntime struct {
+	cliRuntime
+}
+
+func (appleContainerRuntime) Name() string        { return "container" }
+func (appleContainerRuntime) DisplayName() string { return "Apple container" }
+
+func (appleContainerRuntime) Capabilities() RuntimeCapabilities {
+	return RuntimeCapabilities{SSHForwarding: true}
+}
+
+func (appleContainerRuntime) Build(string, string, string, []string) error {
+	return fmt.Errorf("custom images are not supported with Apple container runtime")
+}
+
+func (r appleContainerRuntime) Ping() error {
+	return r.ping("system", "status")
+}
+
+func (appleContainerRuntime) OCIRuntimes() ([]string, error) {
+	return nil, fmt.Errorf("Apple container already runs each container in its own VM and cannot select an OCI runtime")
+}
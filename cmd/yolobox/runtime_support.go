@@ -13,25 +13,22 @@ import (
 
 var currentUID = os.Getuid
 
-// isAppleContainer checks if the resolved runtime is Apple's container tool.
-func isAppleContainer(runtime string) bool {
-	path, err := resolveRuntime(runtime)
-	if err != nil {
-		return false
-	}
-	return strings.HasSuffix(path, "/container")
-}
-
-// isRootlessPodman returns true when the resolved runtime is podman and the
-// current process is not running as root (i.e. rootless mode). Rootless Podman
-// uses a user namespace where the host UID maps to root inside the container,
-// which breaks bind-mount permissions for non-root container users.
-func isRootlessPodman(runtime string) bool {
-	path, err := resolveRuntime(runtime)
-	if err != nil {
-		return false
+// hostSocketsReachable reports whether a Unix socket yolobox creates on the
+// host works when bind-mounted into the engine's containers. Engines in a
+// VM, as on macOS and Windows or with Docker Desktop for Linux, share host
+// files over a filesystem that does not carry sockets; OrbStack forwards
+// them. Tests replace it.
+var hostSocketsReachable = func(rt Runtime) bool {
+	if rt.Name() == "docker" {
+		host := dockerHost()
+		if strings.Contains(host, "/.orbstack/") {
+			return true
+		}
+		if strings.Contains(host, "/.docker/desktop/") {
+			return false
+		}
 	}
-	return strings.HasSuffix(path, "/podman") && currentUID() != 0
+	return runtime.GOOS == "linux"
 }
 
 func persistentVolumeMount(name, target string, rootlessPodman bool) string {
@@ -151,26 +148,22 @@ func prepareFileMountDir(files map[string]string) (string, error) {
 func findDockerSocket() (string, error) {
 	const vmInternalSocket = "/var/run/docker.sock"
 
-	if dh := os.Getenv("DOCKER_HOST"); dh != "" {
-		if strings.HasPrefix(dh, "unix://") {
-			sock := strings.TrimPrefix(dh, "unix://")
-			if _, err := os.Stat(sock); err == nil {
-				if runtime.GOOS == "darwin" {
-					return vmInternalSocket, nil
-				}
-				return sock, nil
-			}
-		}
-	}
-
+	// DOCKER_HOST or the active docker context come first. The Colima
+	// profile is only looked up when nothing else is found, since that may
+	// run colima list.
 	home, _ := os.UserHomeDir()
-	candidates := []string{
-		"/var/run/docker.sock",
-		filepath.Join(home, ".docker", "run", "docker.sock"),
-		filepath.Join(home, ".colima", "default", "docker.sock"),
+	candidates := []func() string{
+		func() string { return unixSocketPath(dockerHost()) },
+		func() string { return "/var/run/docker.sock" },
+		func() string { return filepath.Join(home, ".docker", "run", "docker.sock") },
+		func() string { return colimaSocket(colimaProfile()) },
 	}
 
-	for _, sock := range candidates {
+	for _, candidate := range candidates {
+		sock := candidate()
+		if sock == "" {
+			continue
+		}
 		if _, err := os.Stat(sock); err == nil {
 			if runtime.GOOS == "darwin" {
 				return vmInternalSocket, nil
@@ -194,6 +187,12 @@ func findSSHAgentSocket() (string, error) {
 		return sock, nil
 	}
 
+	// A Colima profile selected by COLIMA_PROFILE, DOCKER_HOST or the
+	// docker context wins over whatever else is installed.
+	if profile, ok := activeColimaProfile(); ok {
+		return colimaSSHAgentSocket(profile)
+	}
+
 	home, _ := os.UserHomeDir()
 
 	dockerDesktopSock := filepath.Join(home, ".docker", "run", "docker.sock")
@@ -201,20 +200,9 @@ func findSSHAgentSocket() (string, error) {
 		return "/run/host-services/ssh-auth.sock", nil
 	}
 
-	colimaSock := filepath.Join(home, ".colima", "default", "docker.sock")
-	if _, err := os.Stat(colimaSock); err == nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		cmd := exec.CommandContext(ctx, "colima", "ssh", "--", "printenv", "SSH_AUTH_SOCK")
-		out, err := cmd.Output()
-		if err != nil {
-			return "", fmt.Errorf("ssh agent forwarding requires Colima's forwardAgent: true.\nEdit ~/.colima/default/colima.yaml, set forwardAgent: true, then: colima stop && colima start")
-		}
-		sock := strings.TrimSpace(string(out))
-		if sock == "" {
-			return "", fmt.Errorf("ssh agent forwarding requires Colima's forwardAgent: true.\nEdit ~/.colima/default/colima.yaml, set forwardAgent: true, then: colima stop && colima start")
-		}
-		return sock, nil
+	profile := colimaProfile()
+	if _, err := os.Stat(colimaSocket(profile)); err == nil {
+		return colimaSSHAgentSocket(profile)
 	}
 
 	if _, err := os.Stat("/var/run/docker.sock"); err == nil {
@@ -224,20 +212,24 @@ func findSSHAgentSocket() (string, error) {
 	return "", fmt.Errorf("could not determine SSH agent socket path for macOS Docker VM")
 }
 
-// ensureDockerNetwork creates the yolobox-net Docker network if it doesn't exist.
-func ensureDockerNetwork(runtimeName string, networkName string) error {
-	runtimePath, err := resolveRuntime(runtimeName)
-	if err != nil {
-		return err
+// colimaSSHAgentSocket asks the profile's VM for its forwarded agent socket.
+func colimaSSHAgentSocket(profile string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "colima", "ssh", "--profile", profile, "--", "printenv", "SSH_AUTH_SOCK")
+	out, err := cmd.Output()
+	sock := strings.TrimSpace(string(out))
+	if err != nil || sock == "" {
+		return "", fmt.Errorf("ssh agent forwarding requires Colima's forwardAgent: true.\nEdit %s, set forwardAgent: true, then: %s && %s",
+			filepath.Join(colimaHome(), profile, "colima.yaml"), colimaCommand(profile, "stop"), colimaCommand(profile, "start"))
 	}
+	return sock, nil
+}
 
-	cmd := exec.Command(runtimePath, "network", "create", networkName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		if strings.Contains(string(output), "already exists") {
-			return nil
-		}
-		return fmt.Errorf("failed to create Docker network %q: %s", networkName, strings.TrimSpace(string(output)))
+// ensureDockerNetwork creates the named network if it doesn't exist.
+func ensureDockerNetwork(rt Runtime, networkName string) error {
+	if err := rt.CreateNetwork(networkName); err != nil {
+		return fmt.Errorf("failed to create Docker network %q: %v", networkName, err)
 	}
 	return nil
 }
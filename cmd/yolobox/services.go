@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ServiceConfig is a [services.<name>] table: a sidecar container started for
+// the session and reachable from the main container by its name.
+type ServiceConfig struct {
+	Image       string   `toml:"image"`
+	Env         []string `toml:"env"`
+	Command     []string `toml:"command"`
+	Healthcheck string   `toml:"healthcheck"`
+}
+
+// serviceStartTimeout bounds how long yolobox waits for a sidecar to pass its
+// healthcheck once it is running. The image pull in `run -d` comes first
+// and is not counted.
+const serviceStartTimeout = 2 * time.Minute
+
+var serviceNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// defaultServiceHealthchecks are used when a service has no healthcheck and
+// its image is one of these. They probe over TCP because the official
+// images run a temporary socket-only server while initializing.
+var defaultServiceHealthchecks = map[string]string{
+	"postgres": "pg_isready -q -h 127.0.0.1",
+	"mysql":    "mysqladmin ping -h 127.0.0.1 --silent",
+	"mariadb":  "mariadb-admin ping -h 127.0.0.1 --silent",
+	"redis":    "redis-cli -h 127.0.0.1 ping",
+	"valkey":   "valkey-cli -h 127.0.0.1 ping",
+	"mongo":    "mongosh --quiet --eval 'db.runCommand({ping: 1})'",
+}
+
+func sortedServiceNames(services map[string]ServiceConfig) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// serviceHealthcheck returns the command that reports the service ready, or
+// "" when the service only needs to be running.
+func serviceHealthcheck(svc ServiceConfig) string {
+	if svc.Healthcheck != "" {
+		return svc.Healthcheck
+	}
+	repo := svc.Image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	if i := strings.LastIndex(repo, "/"); i >= 0 {
+		repo = repo[i+1:]
+	}
+	repo, _, _ = strings.Cut(repo, ":")
+	return defaultServiceHealthchecks[repo]
+}
+
+// serviceEnvName returns the env var that carries the service's host name,
+// e.g. YOLOBOX_SERVICE_POSTGRES.
+func serviceEnvName(name string) string {
+	return "YOLOBOX_SERVICE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func validateServices(cfg Config) error {
+	if len(cfg.Services) == 0 {
+		return nil
+	}
+	for _, name := range sortedServiceNames(cfg.Services) {
+		if !serviceNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid service name %q: use lowercase letters, digits, - and _", name)
+		}
+		if strings.TrimSpace(cfg.Services[name].Image) == "" {
+			return fmt.Errorf("service %q has no image", name)
+		}
+	}
+	switch {
+	case cfg.NoNetwork:
+		return fmt.Errorf("cannot use services with --no-network")
+	case len(cfg.AllowDomains) > 0:
+		return fmt.Errorf("cannot use services with allow_domains")
+	}
+	return nil
+}
+
+// serviceStack is the set of sidecar containers for one session.
+type serviceStack struct {
+	// run invokes the container runtime and returns its combined output.
+	run   func(args ...string) ([]byte, error)
+	sleep func(time.Duration)
+	// aliases means the runtime supports --network-alias.
+	aliases bool
+
+	network        string
+	createdNetwork bool
+	containers     []string
+	signals        chan os.Signal
+	done           chan struct{}
+}
+
+// startServices starts the [services] sidecars before the main container.
+// Without a pod they join a per-session network, which the main container
+// joins too, under their service name. With --pod they share the pod's
+// network and are reached on localhost.
+func startServices(cfg *Config, rt Runtime, sess *session) (*serviceStack, error) {
+	if len(cfg.Services) == 0 {
+		return nil, nil
+	}
+	stack := &serviceStack{
+		run:     rt.CombinedOutput,
+		sleep:   time.Sleep,
+		aliases: rt.Capabilities().NetworkAliases,
+		signals: make(chan os.Signal, 1),
+	}
+	// Interrupts reach the runtime through the terminal's process group.
+	// yolobox keeps running until the main container exits so the sidecars
+	// are always removed. An interrupt while waiting for the sidecars to
+	// become healthy aborts the start; a SIGTERM after that stops the main
+	// container.
+	signal.Notify(stack.signals, os.Interrupt, syscall.SIGTERM)
+
+	if cfg.Pod == "" && cfg.Network == "" {
+		cfg.Network = "yolobox-" + sess.ID
+		if err := ensureDockerNetwork(rt, cfg.Network); err != nil {
+			stack.close()
+			return nil, err
+		}
+		stack.network = cfg.Network
+		stack.createdNetwork = true
+	}
+	if err := stack.start(cfg, cfg.ContainerName); err != nil {
+		stack.close()
+		return nil, err
+	}
+	stack.done = make(chan struct{})
+	go stack.stopOnTerm(cfg.ContainerName)
+	return stack, nil
+}
+
+// stopOnTerm stops the main container when yolobox gets SIGTERM, so the
+// run returns and close removes the sidecars. SIGTERM is not sent through
+// the terminal, so nothing else would end the session.
+func (s *serviceStack) stopOnTerm(container string) {
+	for {
+		select {
+		case sig := <-s.signals:
+			if sig == syscall.SIGTERM {
+				_, _ = s.run("stop", container)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *serviceStack) start(cfg *Config, prefix string) error {
+	for _, name := range sortedServiceNames(cfg.Services) {
+		container := prefix + "-" + name
+		info("Starting service %s (%s)...", name, cfg.Services[name].Image)
+		if out, err := s.run(serviceRunArgs(name, cfg.Services[name], container, *cfg, s.aliases)...); err != nil {
+			return fmt.Errorf("failed to start service %s: %s", name, strings.TrimSpace(string(out)))
+		}
+		s.containers = append(s.containers, container)
+		cfg.Env = append(cfg.Env, serviceEnvName(name)+"="+serviceHost(name, *cfg))
+	}
+	for i, name := range sortedServiceNames(cfg.Services) {
+		if err := s.wait(name, s.containers[i], serviceHealthcheck(cfg.Services[name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceHost is the name the main container reaches the service at.
+func serviceHost(name string, cfg Config) string {
+	if cfg.Pod != "" {
+		return "localhost"
+	}
+	return name
+}
+
+// serviceInvocations returns the runtime calls startServices would make and
+// points cfg at the services the same way, for --dry-run.
+func serviceInvocations(cfg *Config, rt Runtime, sess *session) [][]string {
+	if len(cfg.Services) == 0 {
+		return nil
+	}
+	var calls [][]string
+	if cfg.Pod == "" && cfg.Network == "" {
+		cfg.Network = "yolobox-" + sess.ID
+		calls = append(calls, []string{"network", "create", cfg.Network})
+	}
+	aliases := rt.Capabilities().NetworkAliases
+	for _, name := range sortedServiceNames(cfg.Services) {
+		calls = append(calls, serviceRunArgs(name, cfg.Services[name], cfg.ContainerName+"-"+name, *cfg, aliases))
+		cfg.Env = append(cfg.Env, serviceEnvName(name)+"="+serviceHost(name, *cfg))
+	}
+	return calls
+}
+
+// serviceRunArgs starts the sidecar detached. Without network aliases
+// (nerdctl) the service name is its hostname, which the network's DNS also
+// resolves.
+func serviceRunArgs(name string, svc ServiceConfig, container string, cfg Config, aliases bool) []string {
+	args := []string{"run", "-d", "--name", container, "--label", "yolobox.service=" + name}
+	switch {
+	case cfg.Pod != "":
+		args = append(args, "--pod", cfg.Pod)
+	case aliases:
+		args = append(args, "--network", cfg.Network, "--network-alias", name)
+	default:
+		args = append(args, "--network", cfg.Network, "--hostname", name)
+	}
+	for _, env := range svc.Env {
+		args = append(args, "-e", env)
+	}
+	args = append(args, svc.Image)
+	return append(args, svc.Command...)
+}
+
+// wait polls until the sidecar is running and its healthcheck passes. It
+// gives up when yolobox is interrupted.
+func (s *serviceStack) wait(name, container, healthcheck string) error {
+	deadline := time.Now().Add(serviceStartTimeout)
+	for {
+		select {
+		case <-s.signals:
+			return fmt.Errorf("interrupted while waiting for service %s", name)
+		default:
+		}
+		out, err := s.run("inspect", "--format", "{{.State.Running}}", container)
+		if err != nil || strings.TrimSpace(string(out)) != "true" {
+			return fmt.Errorf("service %s exited during startup:\n%s", name, s.logs(container))
+		}
+		if healthcheck == "" {
+			break
+		}
+		if _, err := s.run("exec", container, "sh", "-c", healthcheck); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("service %s did not become healthy within %s (healthcheck: %s):\n%s", name, serviceStartTimeout, healthcheck, s.logs(container))
+		}
+		s.sleep(time.Second)
+	}
+	success("Service %s is ready", name)
+	return nil
+}
+
+func (s *serviceStack) logs(container string) string {
+	out, _ := s.run("logs", "--tail", "20", container)
+	return strings.TrimSpace(string(out))
+}
+
+func (s *serviceStack) close() {
+	if s.done != nil {
+		close(s.done)
+		s.done = nil
+	}
+	for i := len(s.containers) - 1; i >= 0; i-- {
+		_, _ = s.run("rm", "-f", "-v", s.containers[i])
+	}
+	if s.createdNetwork {
+		_, _ = s.run("network", "rm", s.network)
+	}
+	if s.signals != nil {
+		signal.Stop(s.signals)
+	}
+}
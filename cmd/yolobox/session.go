@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// maxSessions is how many session state directories are kept; older ones are
+// pruned when a new session starts.
+const maxSessions = 50
+
+const sessionInfoFile = "session.json"
+
+// session is the state directory for one yolobox run. Host-side services
+// (network log, port mappings) write their records here so they can be
+// inspected after the fact.
+type session struct {
+	ID      string    `json:"id"`
+	Project string    `json:"project"`
+	Command []string  `json:"command"`
+	Started time.Time `json:"started"`
+
+	Runtime   string        `json:"runtime,omitempty"`
+	Container string        `json:"container,omitempty"`
+	Ports     []portMapping `json:"ports,omitempty"`
+
+	dir string
+}
+
+func sessionsDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".yolobox", "sessions"), nil
+}
+
+// newSessionID returns a sortable ID: start time plus a random suffix so
+// concurrent sessions never collide.
+func newSessionID(now time.Time) (string, error) {
+	buf := make([]byte, 3)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(buf), nil
+}
+
+// startSession creates the state directory for a new run and prunes old ones.
+func startSession(projectDir string, command []string) (*session, error) {
+	base, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(base, 0700); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id, err := newSessionID(now)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{ID: id, Project: projectDir, Command: command, Started: now, dir: filepath.Join(base, id)}
+	if err := os.Mkdir(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create session dir: %w", err)
+	}
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	pruneSessions(base, maxSessions)
+	return s, nil
+}
+
+func (s *session) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.dir, sessionInfoFile), append(data, '\n'), 0600)
+}
+
+func (s *session) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// listSessionIDs returns session IDs oldest first.
+func listSessionIDs(base string) []string {
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sessionIDsByStart returns session IDs oldest first. IDs only sort by
+// second, so sessions started within the same second are ordered by their
+// recorded start time. Unreadable sessions sort first.
+func sessionIDsByStart(base string) []string {
+	ids := listSessionIDs(base)
+	started := make(map[string]time.Time, len(ids))
+	for _, id := range ids {
+		if s, err := readSession(filepath.Join(base, id)); err == nil {
+			started[id] = s.Started
+		}
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return started[ids[i]].Before(started[ids[j]])
+	})
+	return ids
+}
+
+func pruneSessions(base string, keep int) {
+	ids := sessionIDsByStart(base)
+	for len(ids) > keep {
+		_ = os.RemoveAll(filepath.Join(base, ids[0]))
+		ids = ids[1:]
+	}
+}
+
+// loadSession reads a session by ID, or the most recent one when id is empty.
+func loadSession(id string) (*session, error) {
+	base, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		ids := sessionIDsByStart(base)
+		if len(ids) == 0 {
+			return nil, fmt.Errorf("no yolobox sessions found")
+		}
+		return readSession(filepath.Join(base, ids[len(ids)-1]))
+	}
+	return readSession(filepath.Join(base, filepath.Base(id)))
+}
+
+// loadLatestSession returns the most recent session match accepts.
+// Unreadable sessions are skipped.
+func loadLatestSession(match func(*session) bool) (*session, error) {
+	base, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	ids := sessionIDsByStart(base)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if s, err := readSession(filepath.Join(base, ids[i])); err == nil && match(s) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no matching yolobox sessions found")
+}
+
+func readSession(dir string) (*session, error) {
+	id := filepath.Base(dir)
+	data, err := os.ReadFile(filepath.Join(dir, sessionInfoFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session %s not found", id)
+		}
+		return nil, err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to read session %s: %w", id, err)
+	}
+	s.dir = dir
+	return &s, nil
+}
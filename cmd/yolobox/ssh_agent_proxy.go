@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SSH agent protocol message numbers (draft-miller-ssh-agent).
+const (
+	sshAgentFailure            = 5
+	sshAgentcRequestIdentities = 11
+	sshAgentIdentitiesAnswer   = 12
+	sshAgentcSignRequest       = 13
+)
+
+// sshAgentMaxMessage caps message sizes so a misbehaving client cannot make
+// the proxy allocate unbounded memory.
+const sshAgentMaxMessage = 256 * 1024
+
+type sshAgentIdentity struct {
+	blob    []byte
+	comment string
+}
+
+func (id sshAgentIdentity) fingerprint() string {
+	sum := sha256.Sum256(id.blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func validateSSHAgentKeys(cfg Config) error {
+	if len(cfg.SSHAgentKeys) == 0 {
+		if cfg.SSHAgentConfirm {
+			return fmt.Errorf("ssh_agent_confirm requires ssh_agent_keys to select which keys to expose")
+		}
+		return nil
+	}
+	if !cfg.SSHAgent {
+		return fmt.Errorf("ssh_agent_keys requires --ssh-agent")
+	}
+	for _, filter := range cfg.SSHAgentKeys {
+		switch {
+		case strings.HasPrefix(filter, "SHA256:") && len(filter) > len("SHA256:"):
+		case strings.HasPrefix(filter, "comment:") && len(filter) > len("comment:"):
+			if _, err := path.Match(strings.TrimPrefix(filter, "comment:"), ""); err != nil {
+				return fmt.Errorf("invalid ssh_agent_keys entry %q: %w", filter, err)
+			}
+		default:
+			return fmt.Errorf("invalid ssh_agent_keys entry %q; expected SHA256:<fingerprint> or comment:<pattern>", filter)
+		}
+	}
+	return nil
+}
+
+// sshAgentKeyAllowed reports whether id matches any filter. Filters are either
+// an exact SHA256 fingerprint or a comment glob.
+func sshAgentKeyAllowed(filters []string, id sshAgentIdentity) bool {
+	fp := id.fingerprint()
+	for _, filter := range filters {
+		if strings.HasPrefix(filter, "SHA256:") && filter == fp {
+			return true
+		}
+		if pattern, ok := strings.CutPrefix(filter, "comment:"); ok {
+			if matched, _ := path.Match(pattern, id.comment); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sshAgentProxy serves a filtered view of the host SSH agent. Only listing
+// identities and signing with allowed keys are forwarded; adding, removing,
+// locking and extensions are refused.
+type sshAgentProxy struct {
+	upstream string
+	filters  []string
+	confirm  bool
+	approve  func(message string) bool
+
+	dir      string
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+// startSSHAgentProxy starts a filtering proxy in front of the host agent when
+// ssh_agent_keys is set, and points cfg at its socket. Returns nil otherwise.
+func startSSHAgentProxy(cfg *Config) (*sshAgentProxy, error) {
+	if !cfg.SSHAgent || len(cfg.SSHAgentKeys) == 0 {
+		return nil, nil
+	}
+	upstream := os.Getenv("SSH_AUTH_SOCK")
+	if upstream == "" {
+		return nil, fmt.Errorf("ssh_agent_keys requires a running host SSH agent (SSH_AUTH_SOCK is not set)")
+	}
+	dir, err := hostBridgeDir(cfg, "ssh-agent-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ssh agent proxy dir: %w", err)
+	}
+	cfg.SSHAgentSocket = filepath.Join(dir, "agent.sock")
+	if cfg.DryRun != "" {
+		info("Dry run: not starting the SSH agent proxy")
+		return nil, nil
+	}
+
+	proxy := &sshAgentProxy{
+		upstream: upstream,
+		filters:  cfg.SSHAgentKeys,
+		confirm:  cfg.SSHAgentConfirm,
+		approve:  confirmOnHost,
+	}
+	if err := proxy.listen(dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	if ids, err := proxy.upstreamIdentities(); err == nil {
+		allowed := proxy.filterIdentities(ids)
+		if len(allowed) == 0 {
+			warn("No SSH agent keys match ssh_agent_keys; the sandbox will see an empty agent")
+		} else {
+			info("Exposing %d of %d SSH agent keys to the sandbox", len(allowed), len(ids))
+		}
+	}
+	return proxy, nil
+}
+
+func (p *sshAgentProxy) listen(dir string) error {
+	listener, err := listenContainerSocket(dir, "agent.sock")
+	if err != nil {
+		return fmt.Errorf("failed to start ssh agent proxy: %w", err)
+	}
+	p.dir = dir
+	p.listener = listener
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return nil
+}
+
+func (p *sshAgentProxy) close() {
+	_ = p.listener.Close()
+	p.wg.Wait()
+	_ = os.RemoveAll(p.dir)
+}
+
+func (p *sshAgentProxy) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	for {
+		msg, err := readSSHAgentMessage(conn)
+		if err != nil {
+			return
+		}
+		reply := p.handle(msg)
+		if err := writeSSHAgentMessage(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (p *sshAgentProxy) handle(msg []byte) []byte {
+	failure := []byte{sshAgentFailure}
+	if len(msg) == 0 {
+		return failure
+	}
+	switch msg[0] {
+	case sshAgentcRequestIdentities:
+		ids, err := p.upstreamIdentities()
+		if err != nil {
+			return failure
+		}
+		return encodeSSHAgentIdentities(p.filterIdentities(ids))
+	case sshAgentcSignRequest:
+		blob, _, ok := readSSHString(msg[1:])
+		if !ok {
+			return failure
+		}
+		ids, err := p.upstreamIdentities()
+		if err != nil {
+			return failure
+		}
+		var key *sshAgentIdentity
+		for _, id := range p.filterIdentities(ids) {
+			if string(id.blob) == string(blob) {
+				key = &id
+				break
+			}
+		}
+		if key == nil {
+			return failure
+		}
+		if p.confirm {
+			name := key.comment
+			if name == "" {
+				name = key.fingerprint()
+			}
+			if !p.approve(fmt.Sprintf("Allow the sandbox to sign with SSH key %s (%s)?", name, key.fingerprint())) {
+				return failure
+			}
+		}
+		reply, err := p.roundTrip(msg)
+		if err != nil {
+			return failure
+		}
+		return reply
+	default:
+		// Add/remove identities, lock/unlock, smartcard and extension
+		// requests could change or probe the host agent; refuse them all.
+		return failure
+	}
+}
+
+func (p *sshAgentProxy) filterIdentities(ids []sshAgentIdentity) []sshAgentIdentity {
+	var allowed []sshAgentIdentity
+	for _, id := range ids {
+		if sshAgentKeyAllowed(p.filters, id) {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed
+}
+
+func (p *sshAgentProxy) upstreamIdentities() ([]sshAgentIdentity, error) {
+	reply, err := p.roundTrip([]byte{sshAgentcRequestIdentities})
+	if err != nil {
+		return nil, err
+	}
+	return decodeSSHAgentIdentities(reply)
+}
+
+// roundTrip sends one message to the host agent and returns its reply. A
+// fresh connection per request keeps client connections fully independent.
+func (p *sshAgentProxy) roundTrip(msg []byte) ([]byte, error) {
+	conn, err := net.Dial("unix", p.upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if err := writeSSHAgentMessage(conn, msg); err != nil {
+		return nil, err
+	}
+	return readSSHAgentMessage(conn)
+}
+
+func readSSHAgentMessage(r io.Reader) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length == 0 || length > sshAgentMaxMessage {
+		return nil, fmt.Errorf("invalid ssh agent message length %d", length)
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func writeSSHAgentMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(buf, uint32(len(msg)))
+	copy(buf[4:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readSSHString(data []byte) ([]byte, []byte, bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return nil, nil, false
+	}
+	return data[4 : 4+length], data[4+length:], true
+}
+
+func appendSSHString(buf, s []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
+
+func decodeSSHAgentIdentities(msg []byte) ([]sshAgentIdentity, error) {
+	if len(msg) < 5 || msg[0] != sshAgentIdentitiesAnswer {
+		return nil, errors.New("unexpected ssh agent identities reply")
+	}
+	count := binary.BigEndian.Uint32(msg[1:5])
+	rest := msg[5:]
+	var ids []sshAgentIdentity
+	for i := uint32(0); i < count; i++ {
+		blob, next, ok := readSSHString(rest)
+		if !ok {
+			return nil, errors.New("truncated ssh agent identities reply")
+		}
+		comment, next, ok := readSSHString(next)
+		if !ok {
+			return nil, errors.New("truncated ssh agent identities reply")
+		}
+		ids = append(ids, sshAgentIdentity{blob: blob, comment: string(comment)})
+		rest = next
+	}
+	return ids, nil
+}
+
+func encodeSSHAgentIdentities(ids []sshAgentIdentity) []byte {
+	buf := []byte{sshAgentIdentitiesAnswer}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(ids)))
+	for _, id := range ids {
+		buf = appendSSHString(buf, id.blob)
+		buf = appendSSHString(buf, []byte(id.comment))
+	}
+	return buf
+}
@@ -24,32 +24,32 @@ func versionCachePath() string {
 	return filepath.Join(configDir, "yolobox", "version-check.json")
 }
 
+// checkForUpdates shows the result of the last check and, when that is older
+// than versionCheckInterval, refreshes it in the background. Startup never
+// waits on the network; a newer release found now is shown on the next run.
 func checkForUpdates() {
-	done := make(chan struct{})
-	go func() {
-		defer close(done)
-		doVersionCheck()
-	}()
-
-	select {
-	case <-done:
-	case <-time.After(5 * time.Second):
+	cache, err := readVersionCache(versionCachePath())
+	if err == nil {
+		showUpdateMessage(cache.LatestVersion)
+		if time.Since(cache.CheckedAt) < versionCheckInterval {
+			return
+		}
 	}
+	go refreshVersionCache()
 }
 
-func doVersionCheck() {
-	cachePath := versionCachePath()
-
+func readVersionCache(path string) (versionCache, error) {
 	var cache versionCache
-	if data, err := os.ReadFile(cachePath); err == nil {
-		if err := json.Unmarshal(data, &cache); err == nil {
-			if time.Since(cache.CheckedAt) < versionCheckInterval {
-				showUpdateMessage(cache.LatestVersion)
-				return
-			}
-		}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache, err
 	}
+	err = json.Unmarshal(data, &cache)
+	return cache, err
+}
 
+// refreshVersionCache fetches the latest release into the version cache.
+func refreshVersionCache() {
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Get("https://api.github.com/repos/finbarr/yolobox/releases/latest")
 	if err != nil {
@@ -70,18 +70,16 @@ func doVersionCheck() {
 		return
 	}
 
-	latestVersion := strings.TrimPrefix(release.TagName, "v")
-	cache = versionCache{
-		LatestVersion: latestVersion,
+	cache := versionCache{
+		LatestVersion: strings.TrimPrefix(release.TagName, "v"),
 		CheckedAt:     time.Now(),
 	}
+	cachePath := versionCachePath()
 	if data, err := json.Marshal(cache); err == nil {
 		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
-			_ = os.WriteFile(cachePath, data, 0644)
+			_ = writeFileAtomic(cachePath, data, 0644)
 		}
 	}
-
-	showUpdateMessage(latestVersion)
 }
 
 func showUpdateMessage(latestVersion string) {